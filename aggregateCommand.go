@@ -0,0 +1,96 @@
+package main
+
+import (
+	"AT/timeseries"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+func init() {
+	subcommands["aggregate"] = runAggregate
+}
+
+// runAggregate выводит только ряд количества событий по интервалам,
+// без спектрального анализа: AT aggregate -input file -by day [flags]
+func runAggregate(args []string) {
+	flags := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Path to input file with timestamps (.csv, .txt, .jsonl; optionally .gz)")
+	outputFile := flags.String("output", "", "Path to output file (default: stdout)")
+	by := flags.String("by", "day", "Aggregation interval: hour, day, week, month or year")
+	format := flags.String("format", "csv", "Output format: csv, json or influx (InfluxDB line protocol)")
+	jsonField := flags.String("json-field", "ts", "Timestamp field in .jsonl/.ndjson input; dotted path for nested objects")
+	timezone := flags.String("timezone", "", "IANA time zone for calendar intervals (default: local) and for timestamps without offset (default: UTC)")
+	timestampUnit := flags.String("timestamp-unit", "auto", "Unit of numeric timestamps: ms, s or auto (decided once per column by its first number: integer = ms, fractional = s)")
+	weekStart := flags.String("week-start", "monday", "First day of the week for -by week")
+	maxBuckets := flags.Int("max-aggregation-buckets", 10000, "Maximum series length; longer ranges list only non-empty buckets (0 = unlimited)")
+	flags.Parse(args)
+
+	if *inputFile == "" {
+		log.Fatal("Input file is required. Use -input flag to specify timestamps file")
+	}
+	if *format != "csv" && *format != "json" && *format != formatInflux {
+		log.Fatalf("Unknown format %q: expected csv, json or influx", *format)
+	}
+	var err error
+	if defaultTimestampUnit, err = parseTimestampUnit(*timestampUnit); err != nil {
+		log.Fatal(err)
+	}
+
+	config := timeseries.DefaultPeriodConfig()
+	config.MaxAggregationBuckets = *maxBuckets
+	weekStartDay, err := parseWeekday(*weekStart)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.WeekStart = &weekStartDay
+	if *timezone != "" {
+		if config.Location, err = time.LoadLocation(*timezone); err != nil {
+			log.Fatalf("Invalid timezone: %v", err)
+		}
+		timestampLocation = config.Location
+	}
+
+	timestamps, err := loadTimestamps(*inputFile, *jsonField, nil)
+	if err != nil {
+		log.Fatalf("Failed to load timestamps: %v", err)
+	}
+
+	if *format == "json" {
+		buckets, err := timeseries.AggregateTimestamps(timestamps, timeseries.AggregationUnit(*by), config)
+		if err != nil {
+			log.Fatalf("Aggregation failed: %v", err)
+		}
+		writeOutput(buckets, *outputFile)
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if *format == formatInflux {
+		buckets, err := timeseries.AggregateTimestamps(timestamps, timeseries.AggregationUnit(*by), config)
+		if err != nil {
+			log.Fatalf("Aggregation failed: %v", err)
+		}
+		for _, b := range buckets {
+			writeInfluxPoint(out, *by, b.Count, b.Start)
+		}
+		return
+	}
+
+	// CSV записывается потоково, без построения ряда в памяти
+
+	if err := timeseries.WriteSeriesCSV(out, timestamps, timeseries.AggregationUnit(*by), config); err != nil {
+		log.Fatalf("Aggregation failed: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package timeseries
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AggregationUnit определяет интервал агрегации для AggregateTimestamps
+type AggregationUnit string
+
+const (
+	AggregateHour  AggregationUnit = "hour"
+	AggregateDay   AggregationUnit = "day"
+	AggregateWeek  AggregationUnit = "week"
+	AggregateMonth AggregationUnit = "month"
+	AggregateYear  AggregationUnit = "year"
+)
+
+// Bucket - количество событий в интервале агрегации, начинающемся в Start
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+	Rate  float64   `json:"rate"` // Событий в час с учетом фактической длительности интервала, см. bucketRate
+}
+
+// AggregateTimestamps строит ряд количества событий по интервалам unit без
+// спектрального анализа. Используются Location (или Timezone), WeekStart и MaxAggregationBuckets
+// из config; пропуски заполняются нулями так же, как в AnalysisResult.
+func AggregateTimestamps(timestamps []int64, unit AggregationUnit, config PeriodConfig) ([]Bucket, error) {
+	if len(timestamps) == 0 {
+		return nil, errors.New("no timestamps provided")
+	}
+	if config.MaxAggregationBuckets < 0 {
+		return nil, errors.New("maxAggregationBuckets must not be negative")
+	}
+	if err := config.resolveLocation(); err != nil {
+		return nil, err
+	}
+
+	loc := config.location()
+	times := make([]time.Time, len(timestamps))
+	for i, ts := range timestamps {
+		times[i] = time.Unix(ts/1000, (ts%1000)*int64(time.Millisecond)).In(loc)
+	}
+
+	var buckets []Bucket
+	switch unit {
+	case AggregateHour:
+		buckets, _ = aggregateByHour(times, config.MaxAggregationBuckets)
+	case AggregateDay:
+		days, _ := aggregateByDay(times, config.MaxAggregationBuckets)
+		for _, d := range days {
+			buckets = append(buckets, Bucket{Start: d.Date, Count: d.Count, Rate: d.Rate})
+		}
+	case AggregateWeek:
+		for _, w := range aggregateByWeek(times, config.weekStart()) {
+			buckets = append(buckets, Bucket{Start: w.Week, Count: w.Count, Rate: w.Rate})
+		}
+	case AggregateMonth:
+		months, _ := aggregateByMonth(times, config.MaxAggregationBuckets)
+		for _, m := range months {
+			buckets = append(buckets, Bucket{Start: m.Month, Count: m.Count, Rate: m.Rate})
+		}
+	case AggregateYear:
+		buckets = aggregateByYear(times)
+	default:
+		return nil, fmt.Errorf("unknown aggregation unit %q", unit)
+	}
+
+	return buckets, nil
+}
+
+// WriteSeriesCSV записывает ряд количества событий по интервалам unit в w как CSV
+// со строками "start,count,rate", формируя строки по мере обхода диапазона. В памяти
+// хранятся только счетчики непустых интервалов, поэтому даже для многолетних рядов
+// по часам память не зависит от длины диапазона. Содержимое совпадает с
+// AggregateTimestamps: пропуски заполняются нулями (кроме недель), а при превышении
+// MaxAggregationBuckets выводятся только непустые интервалы. rate - Bucket.Rate,
+// событий в час с учетом фактической длительности интервала.
+func WriteSeriesCSV(w io.Writer, timestamps []int64, unit AggregationUnit, config PeriodConfig) error {
+	if len(timestamps) == 0 {
+		return errors.New("no timestamps provided")
+	}
+	if config.MaxAggregationBuckets < 0 {
+		return errors.New("maxAggregationBuckets must not be negative")
+	}
+	switch unit {
+	case AggregateHour, AggregateDay, AggregateWeek, AggregateMonth, AggregateYear:
+	default:
+		return fmt.Errorf("unknown aggregation unit %q", unit)
+	}
+	if err := config.resolveLocation(); err != nil {
+		return err
+	}
+
+	// Счетчики по началу интервала в секундах Unix
+	loc := config.location()
+	counts := make(map[int64]int)
+	var first, last time.Time
+	for _, ts := range timestamps {
+		t := time.Unix(ts/1000, (ts%1000)*int64(time.Millisecond)).In(loc)
+		start := bucketStart(t, unit, config.weekStart())
+		counts[start.Unix()]++
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if last.IsZero() || start.After(last) {
+			last = start
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writeRow := func(start time.Time, count int) {
+		writer.Write([]string{
+			start.Format(time.RFC3339),
+			strconv.Itoa(count),
+			strconv.FormatFloat(bucketRate(count, start, unit), 'g', -1, 64),
+		})
+	}
+	writer.Write([]string{"start", "count", "rate"})
+
+	// Недели не заполняются, как и в WeekRecord; слишком длинный диапазон - только непустые интервалы
+	if unit == AggregateWeek || bucketsExceed(first, last, unit, config.MaxAggregationBuckets) {
+		keys := make([]int64, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		for _, key := range keys {
+			writeRow(time.Unix(key, 0).In(loc), counts[key])
+		}
+	} else {
+		for current := first; !current.After(last); current = nextBucket(current, unit) {
+			writeRow(current, counts[current.Unix()])
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// bucketStart возвращает начало интервала unit, содержащего t, по местному времени t
+func bucketStart(t time.Time, unit AggregationUnit, weekStart time.Weekday) time.Time {
+	switch unit {
+	case AggregateHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case AggregateWeek:
+		daysToWeekStart := (int(t.Weekday()) - int(weekStart) + 7) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysToWeekStart, 0, 0, 0, 0, t.Location())
+	case AggregateMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case AggregateYear:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// nextBucket возвращает начало интервала unit, следующего за начинающимся в start
+func nextBucket(start time.Time, unit AggregationUnit) time.Time {
+	switch unit {
+	case AggregateHour:
+		return start.Add(time.Hour)
+	case AggregateWeek:
+		return start.AddDate(0, 0, 7)
+	case AggregateMonth:
+		return start.AddDate(0, 1, 0)
+	case AggregateYear:
+		return start.AddDate(1, 0, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// bucketEnd возвращает конец интервала unit, начинающегося в start, по местному
+// времени: сутки перехода на летнее время длятся 23 или 25 часов. В отличие от
+// nextBucket, час, повторяющийся при переводе часов назад, заканчивается вместе
+// с повтором, так как его начало по местному времени объединяет события обоих.
+func bucketEnd(start time.Time, unit AggregationUnit) time.Time {
+	if unit == AggregateHour {
+		return time.Date(start.Year(), start.Month(), start.Day(), start.Hour()+1, 0, 0, 0, start.Location())
+	}
+	return nextBucket(start, unit)
+}
+
+// bucketRate возвращает количество событий count в час для интервала unit,
+// начинающегося в start, с учетом его фактической длительности
+func bucketRate(count int, start time.Time, unit AggregationUnit) float64 {
+	hours := bucketEnd(start, unit).Sub(start).Hours()
+	if hours <= 0 {
+		return 0
+	}
+	return float64(count) / hours
+}
+
+// bucketsExceed проверяет, содержит ли диапазон [first, last] больше maxBuckets интервалов
+func bucketsExceed(first, last time.Time, unit AggregationUnit, maxBuckets int) bool {
+	if maxBuckets <= 0 {
+		return false
+	}
+	n := 0
+	for current := first; !current.After(last); current = nextBucket(current, unit) {
+		if n++; n > maxBuckets {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateByHour агрегирует данные по часам. Если полный ряд длиннее maxBuckets
+// (при maxBuckets > 0), возвращаются только часы с событиями и признак sparse.
+func aggregateByHour(times []time.Time, maxBuckets int) (result []Bucket, sparse bool) {
+	// Ключ - начало часа в секундах Unix: сравнение time.Time как ключей map
+	// зависит от представления часового пояса
+	hourMap := make(map[int64]int)
+	for _, t := range times {
+		hour := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+		hourMap[hour.Unix()]++
+	}
+
+	// Определяем временной диапазон
+	loc := times[0].Location()
+	var minHour, maxHour time.Time
+	for key := range hourMap {
+		hour := time.Unix(key, 0).In(loc)
+		if minHour.IsZero() || hour.Before(minHour) {
+			minHour = hour
+		}
+		if maxHour.IsZero() || hour.After(maxHour) {
+			maxHour = hour
+		}
+	}
+
+	// Слишком длинный диапазон: только часы с событиями
+	if maxBuckets > 0 && int(maxHour.Sub(minHour).Hours())+1 > maxBuckets {
+		for key, count := range hourMap {
+			start := time.Unix(key, 0).In(loc)
+			result = append(result, Bucket{Start: start, Count: count, Rate: bucketRate(count, start, AggregateHour)})
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Start.Before(result[j].Start)
+		})
+		return result, true
+	}
+
+	// Генерируем полный ряд. Шаг - абсолютный час, поэтому при переходе
+	// на летнее время ряд не содержит повторов и пропусков
+	for current := minHour; !current.After(maxHour); current = current.Add(time.Hour) {
+		count := hourMap[current.Unix()]
+		result = append(result, Bucket{Start: current, Count: count, Rate: bucketRate(count, current, AggregateHour)})
+	}
+
+	return result, false
+}
+
+// aggregateByYear агрегирует данные по календарным годам
+func aggregateByYear(times []time.Time) []Bucket {
+	yearMap := make(map[int]int)
+	minYear, maxYear := times[0].Year(), times[0].Year()
+	for _, t := range times {
+		yearMap[t.Year()]++
+		if t.Year() < minYear {
+			minYear = t.Year()
+		}
+		if t.Year() > maxYear {
+			maxYear = t.Year()
+		}
+	}
+
+	loc := times[0].Location()
+	result := make([]Bucket, 0, maxYear-minYear+1)
+	for year := minYear; year <= maxYear; year++ {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+		result = append(result, Bucket{
+			Start: start,
+			Count: yearMap[year],
+			Rate:  bucketRate(yearMap[year], start, AggregateYear),
+		})
+	}
+
+	return result
+}
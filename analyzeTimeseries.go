@@ -1,26 +1,522 @@
 package timeseries
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
-// PeriodConfig содержит параметры для спектрального анализа
+// PeriodConfig содержит параметры для спектрального анализа. В JSON (AnalysisResult.EffectiveConfig,
+// файл -config) поля называются так же, как в Go; явные теги json фиксируют эти имена.
 type PeriodConfig struct {
 	MinPeriod      float64 // Минимальный период в часах (по умолчанию 0.1)
 	MaxPeriod      float64 // Максимальный период в часах (по умолчанию 8760)
 	NumPeriods     int     // Количество возвращаемых периодов (по умолчанию 5)
 	SamplesPerPeak int     // Количество сэмплов на пик (по умолчанию 5)
+	ByWeekday      bool    // Дополнительный анализ периодов отдельно по дням недели
+	SkipContinuous bool    // Пропустить анализ непрерывных периодов (Continuous останется пустым)
+	MinProminence  float64 // Минимальное превышение пика над соседями, доля от максимальной мощности (0 - любой локальный максимум)
+
+	// ByMonth включает дополнительный анализ периодов отдельно по календарным месяцам
+	// Location; MonthKeyFormat задает вид ключей результата (по умолчанию MonthKeyISO)
+	ByMonth        bool
+	MonthKeyFormat MonthKeyFormat
+
+	// MinQuarterRecords - наименьшее количество событий квартала, при котором для него
+	// ищутся периоды; более редкие кварталы (обычно неполные первый и последний)
+	// пропускаются и перечисляются в AnalysisResult.SkippedQuarters. 0 - без ограничения,
+	// в DefaultPeriodConfig - 50.
+	MinQuarterRecords int
+
+	// SkipAggregation пропускает построение рядов по дням, неделям и месяцам
+	// (Days, Weeks и Months останутся nil), если нужен только спектральный анализ
+	SkipAggregation bool
+
+	// IncludeScopeSamples добавляет в результат временные метки, попавшие в окна daily и weekly
+	IncludeScopeSamples bool
+
+	// Cumulative добавляет в результат ряд CumulativeDays с накопленным итогом по дням.
+	// Ряд строится из ряда по дням, поэтому при SkipAggregation он пуст.
+	Cumulative bool
+
+	// SmoothingWindow - если больше нуля, каждый день ряда Days получает SmoothedCount -
+	// центрированное скользящее среднее Count по SmoothingWindow интервалам (при четном
+	// окне справа на один интервал больше). У краев ряда окно сокращается до
+	// имеющихся интервалов. При разреженном ряде (см. MaxAggregationBuckets) интервалы -
+	// только дни с событиями.
+	SmoothingWindow int
+
+	// Model - модель вычисления мощности периодограммы (по умолчанию ModelStandard)
+	Model PowerModel
+
+	// SpectrumScopes - области, для которых в результат включается полная периодограмма
+	// (например, "allTime", "daily", "quarterly"). По умолчанию спектры не включаются.
+	SpectrumScopes []string
+
+	// SpectrumPreviewBins - если больше нуля, спектры SpectrumScopes заменяются
+	// уменьшенными до SpectrumPreviewBins отсчетов для миниатюр графиков. Частоты
+	// делятся на равные группы подряд идущих отсчетов, и из каждой берется отсчет
+	// с наибольшей мощностью, поэтому пики сохраняются вместе со своими частотами.
+	SpectrumPreviewBins int
+
+	// ScopeNumPeriods переопределяет NumPeriods для отдельных областей. Ключ - название
+	// области ("daily", "allTime", "quarterly") или полное имя составной области
+	// ("quarterly/2023-Q1", "continuous.allData/daily"); полное имя имеет приоритет.
+	// Для областей без переопределения используется NumPeriods.
+	ScopeNumPeriods map[string]int
+
+	// SampleFraction - доля событий (0 < f <= 1), случайно отбираемых перед анализом
+	// для быстрого приближенного результата; выборка детерминирована Seed. Ноль и 1 -
+	// все события. Мощность периодического сигнала в периодограмме растет
+	// пропорционально числу событий, а мощность шума от него не зависит, поэтому на
+	// выборке Power, Significance и ZScore сильных периодов уменьшаются примерно в
+	// 1/f раз, а PValue растет; сами периоды сохраняются, пока сигнал заметно выше шума,
+	// но слабые периоды могут исчезнуть. Ряды Days, Weeks и Months тоже строятся по
+	// выборке, и количества в них уменьшаются в 1/f раз.
+	SampleFraction float64 `json:"SampleFraction"`
+
+	// RefinePeaks уточняет частоту и мощность найденных пиков дополнительными
+	// вычислениями мощности между отсчетами сетки вокруг каждого пика
+	RefinePeaks bool `json:"RefinePeaks"`
+
+	// Fundamental включает выбор основного периода области allTime с учетом
+	// гармоник, см. AnalysisResult.Fundamental
+	Fundamental bool
+
+	// Describe включает PeriodResult.Description - описание суточных и недельных
+	// периодов для расписаний, например "daily ~09:00" или "weekly on Mondays"
+	Describe bool
+
+	// IncludeRawComponents добавляет к каждому периоду PeriodResult.Raw - суммы,
+	// из которых вычислена мощность, для собственной нормировки и тестов значимости
+	IncludeRawComponents bool
+
+	// CumulativeSignificance - если задано (доля от 0 до 1, например 0.9), вместо
+	// NumPeriods и ScopeNumPeriods возвращается наименьшее число самых мощных пиков,
+	// суммарная Significance которых достигает этой доли общей мощности. Если все
+	// пики вместе не достигают порога, возвращаются все. Общая мощность включает
+	// все отсчеты сетки, а не только пики, поэтому на мелкой сетке разумны малые пороги.
+	CumulativeSignificance float64 `json:"CumulativeSignificance"`
+
+	// ScopePeriodRanges переопределяет диапазон периодов [MinPeriod, MaxPeriod] для
+	// отдельных областей; ключи - как в ScopeNumPeriods. Нулевая граница берется из
+	// общей конфигурации. Для daily и weekly без собственного диапазона действуют
+	// defaultScopePeriodRanges (1-72 и 12-336 часов), но каждая их граница - только
+	// пока соответствующая граница MinPeriod/MaxPeriod оставлена по умолчанию, так что
+	// явно заданный MinPeriod/MaxPeriod не заменяется молча. Итоговые диапазоны
+	// записываются в EffectiveConfig; по ним же оценивается MaxOperations.
+	ScopePeriodRanges map[string]PeriodRange `json:"ScopePeriodRanges"`
+
+	// Jitter - ширина детерминированного (по Seed) случайного сдвига совпадающих временных меток.
+	// Повторяющиеся метки складываются когерентно на всех частотах, а при квантовании
+	// времени (например, до секунд) дают ложные пики на частотах, кратных шагу квантования;
+	// сдвиг в пределах ±Jitter/2 разрушает эту структуру. 0 - без сдвига.
+	Jitter time.Duration
+
+	// PeriodTolerance - относительный допуск, при котором два периода считаются одинаковыми
+	// при сравнении и объединении результатов (0.05 = 5%: 24.0h и 24.5h совпадают,
+	// 24.0h и 168.0h - нет). 0 - DefaultPeriodTolerance.
+	PeriodTolerance float64
+
+	// ExcludePeriods - известные периоды-артефакты в часах (например, 24 для ежесуточного
+	// cron), которые не должны попадать в результат. Частоты, совпадающие с ними с допуском
+	// PeriodTolerance, обнуляются перед поиском пиков. Это маска над вычисленной
+	// периодограммой: спектры в Spectra и нормировка Significance ее не учитывают.
+	ExcludePeriods []float64 `json:"ExcludePeriods"`
+
+	// WeekStart - первый день недели для агрегации по неделям; nil - понедельник, как в
+	// ISO 8601. Указатель, чтобы незаданное поле не превращалось в воскресенье - нулевое
+	// значение time.Weekday.
+	WeekStart *time.Weekday
+
+	// AnchorToNow привязывает окна daily и weekly к текущему времени Clock, а не к последней
+	// метке данных, чтобы пустые последние часы тоже входили в окно. Окно остается
+	// интервалом filterByTimeRange: [now - окно, now + 24h]; непрерывные периоды
+	// по-прежнему привязаны к концу своих данных.
+	AnchorToNow bool
+
+	// Clock возвращает текущее время (по умолчанию time.Now); задается в тестах и сервисах
+	Clock func() time.Time `json:"-"`
+
+	// Adaptive включает адаптивную периодограмму: диапазон частот делится на логарифмические
+	// полосы со своим разрешением вместо одной линейной сетки
+	Adaptive bool
+
+	// Seed - зерно для всех случайных этапов анализа. При одинаковых входных данных
+	// и Seed результат детерминирован, включая порядок предупреждений и ResultSink.
+	Seed int64
+
+	// MaxAggregationBuckets ограничивает длину рядов по дням и месяцам. Если диапазон
+	// дат требует больше интервалов (например, из-за выброса в 2099 году), пропуски
+	// не заполняются нулями и ряд содержит только дни и месяцы с событиями.
+	// Нулевое значение снимает ограничение.
+	MaxAggregationBuckets int
+
+	// Deadline ограничивает длительность спектрального анализа. Области, не успевшие
+	// завершиться до истечения срока, пропускаются: результат возвращается частично
+	// заполненным с предупреждением, перечисляющим пропущенные области. Для
+	// AnalyzeGroups срок отсчитывается для каждой группы отдельно. Время берется из
+	// Clock, поэтому срок можно проверять в тестах без ожидания. Ноль - без ограничения.
+	Deadline time.Duration
+
+	// MaxOperations ограничивает оценку количества вычислений sin/cos (частоты × события
+	// × проходы по данным). Если оценка больше, анализ не запускается и возвращается
+	// ошибка. Защищает сервер от запросов, которые выполнялись бы часами. Ноль - без ограничения.
+	MaxOperations int64
+
+	// ReferencePeriod - опорный период в часах (например, 24). Если задан, каждый
+	// найденный период дополняется отношением PeriodRatio = Period / ReferencePeriod.
+	ReferencePeriod float64
+
+	// PeakNeighborhood - полуширина окрестности пика в отсчетах периодограммы: отсчет
+	// считается пиком, только если он строго больше всех отсчетов в пределах ±PeakNeighborhood,
+	// а MinProminence отсчитывается от максимума этой окрестности. На мелкой сетке это
+	// не дает склонам одного широкого пика давать множество мелких максимумов.
+	// Ноль эквивалентен 1 - сравнению только с непосредственными соседями.
+	PeakNeighborhood int `json:"PeakNeighborhood"`
+
+	// EdgeExclusionBins - число крайних отсчетов периодограммы с каждой стороны сетки,
+	// в которых пики не ищутся. Пик у края сетки дает период, равный MinPeriod или
+	// MaxPeriod, и обычно вызван краевым артефактом, а не настоящей периодичностью.
+	// Сами крайние отсчеты не бывают пиками и при нуле.
+	EdgeExclusionBins int `json:"EdgeExclusionBins"`
+
+	// WeeklyWindow - длительность окна области weekly, отсчитываемого от последней метки
+	// (по умолчанию в DefaultPeriodConfig - 4 недели). Для надежного выделения недельного
+	// периода окно должно охватывать несколько недель; если данные окна охватывают
+	// меньше weeklyMinWeeks недель, выдается предупреждение. Ноль - 4 недели.
+	WeeklyWindow time.Duration
+
+	// MaxGap - наибольшее расстояние между началами соседних дней с событиями, при
+	// котором они относятся к одному непрерывному отрезку. Ноль - 48 часов, то есть
+	// допускается один пустой день.
+	MaxGap time.Duration
+
+	// IncludeLongestContinuousRecords добавляет в ContinuousResult метки самого
+	// длинного непрерывного периода, чтобы его можно было выгрузить отдельно
+	IncludeLongestContinuousRecords bool
+
+	// MinSegmentDays - минимальное количество дней с событиями в отрезке, попадающем
+	// в AllContinuousSegments. Ноль - все отрезки.
+	MinSegmentDays int
+
+	// BinWidth - ширина интервалов, в которые группируются события перед вычислением
+	// периодограммы: события интервала заменяются одним отсчетом в его середине с весом,
+	// равным количеству (сумме значений) событий. Сокращает расчет для плотных данных
+	// ценой потери периодов короче двух BinWidth, которые не ищутся. Интервалы отсчитываются от Epoch или
+	// начала области. Данные не должны делиться более чем на maxBins интервалов. Ноль - без группировки.
+	BinWidth time.Duration
+
+	// NoiseModel - модель шума количества событий в интервалах BinWidth (по умолчанию
+	// NoiseGaussian). Без BinWidth каждое событие - отдельный отсчет, и модели совпадают.
+	NoiseModel NoiseModel
+
+	// IncludeBinnedSeries добавляет в результат ряды интервалов BinWidth, по которым
+	// вычислены периодограммы областей (см. AnalysisResult.BinnedSeries)
+	IncludeBinnedSeries bool
+
+	// AssumeSorted сообщает, что метки уже упорядочены по времени, и отменяет их
+	// сортировку (O(N log N)) перед анализом. Порядок проверяется за один проход,
+	// и при нарушении возвращается ошибка. После Jitter метки сортируются в любом случае.
+	AssumeSorted bool `json:"AssumeSorted"`
+
+	// RollingWindow включает анализ скользящих окон: ряд окон длительностью RollingWindow,
+	// начинающихся с первой метки через каждые RollingStep, анализируется отдельно, что
+	// показывает дрейф периодов во времени. Ноль отключает анализ.
+	RollingWindow time.Duration
+
+	// RollingStep - сдвиг между началами соседних окон, 0 < RollingStep <= RollingWindow.
+	// При RollingStep < RollingWindow окна перекрываются: меньший шаг дает более плавное
+	// отслеживание дрейфа, но количество окон и время расчета растут как
+	// RollingWindow / RollingStep раз на каждую длительность окна. Окон должно быть
+	// не более maxRollingWindows.
+	RollingStep time.Duration
+
+	// MinCycles - минимальное число циклов периода, которое должно укладываться в
+	// интервал данных области. Периоды длиннее длительности области / MinCycles
+	// исключаются из результата с предупреждением (по умолчанию в DefaultPeriodConfig - 2).
+	// Ноль отключает проверку. Независимо от проверки MaxPeriod каждой области
+	// ограничивается длительностью ее данных / max(MinCycles, 2), см.
+	// AnalysisResult.EffectivePeriodRanges.
+	MinCycles float64
+
+	// Parallelism - количество областей анализа (daily, weekly, allTime, кварталы,
+	// дни недели, непрерывные области), обрабатываемых одновременно. Значения 0 и 1
+	// означают последовательный анализ. При параллельном анализе порядок предупреждений
+	// и отправки в ResultSink не определен, но сами результаты не меняются.
+	Parallelism int
+
+	// Epoch - общее начало отсчета времени для всех областей, чтобы фазы разных окон
+	// были сопоставимы. Нулевое значение - отсчет от минимального времени каждой области.
+	Epoch time.Time
+
+	// Location - часовой пояс, в котором определяются календарные дни, недели и
+	// рабочие часы. nil - локальный часовой пояс процесса.
+	//
+	// Временные метки - абсолютные моменты времени: смещение, с которым метка была
+	// записана ("2023-06-01T21:00:00+09:00"), определяет только момент и не сохраняется.
+	// Все метки переводятся в Location, и границы интервалов агрегации берутся по
+	// местному времени Location. Так, событие в 21:00 по Токио при Location = Asia/Tokyo
+	// относится к 1 июня, а при Location = UTC - к 1 июня 12:00 UTC.
+	Location *time.Location `json:"-"`
+
+	// Timezone - имя часового пояса IANA ("Asia/Tokyo"), используемое, если Location
+	// не задан; пустая строка - локальный часовой пояс процесса. В JSON часовой пояс
+	// передается только так: в EffectiveConfig здесь имя фактического Location.
+	Timezone string `json:"Timezone,omitempty"`
+
+	// BusinessHours - если задано, анализируются только события в рабочие часы,
+	// остальные исключаются до обнаружения периодов
+	BusinessHours *BusinessHours
+
+	// ResultSink - необязательный канал, в который отправляется результат каждой
+	// области анализа сразу после его вычисления. Канал не закрывается анализом,
+	// отправка блокирующая, поэтому читать из него нужно параллельно с вызовом.
+	ResultSink chan<- ScopeResult `json:"-"`
+}
+
+// BusinessHours задает рабочие часы [Start, End) в активные дни недели
+type BusinessHours struct {
+	Start    int            `json:"start"`    // Час начала (0-23), включительно
+	End      int            `json:"end"`      // Час окончания (1-24), не включительно
+	Weekdays []time.Weekday `json:"weekdays"` // Активные дни; пустой список - с понедельника по пятницу
+}
+
+// contains проверяет, попадает ли момент t в рабочие часы
+func (bh *BusinessHours) contains(t time.Time) bool {
+	if t.Hour() < bh.Start || t.Hour() >= bh.End {
+		return false
+	}
+	if len(bh.Weekdays) == 0 {
+		return t.Weekday() >= time.Monday && t.Weekday() <= time.Friday
+	}
+	for _, day := range bh.Weekdays {
+		if t.Weekday() == day {
+			return true
+		}
+	}
+	return false
+}
+
+// PeriodRange - диапазон периодов в часах; нулевая граница не задана
+type PeriodRange struct {
+	Min float64
+	Max float64
+}
+
+// MonthKeyFormat определяет вид ключей месяцев в PeriodResults.Monthly
+type MonthKeyFormat string
+
+const (
+	MonthKeyISO   MonthKeyFormat = "iso"   // "2023-06"
+	MonthKeyNamed MonthKeyFormat = "named" // "June 2023"
+)
+
+// NoiseModel определяет веса интервалов BinWidth в периодограмме
+type NoiseModel string
+
+const (
+	// NoiseGaussian - одинаковая дисперсия всех интервалов: вес интервала равен
+	// количеству событий в нем, как если бы события не группировались
+	NoiseGaussian NoiseModel = "gaussian"
+
+	// NoisePoisson - количество событий в интервале распределено по Пуассону, и его
+	// дисперсия равна среднему. Ряд количеств всех интервалов, включая пустые,
+	// анализируется как измерения (см. AnalyzeMeasurements) взвешенной периодограммой
+	// Ломба-Скаргла с весами, обратными дисперсии: 1/max(count, 1), где наблюдаемое
+	// количество - оценка среднего, а ограничение снизу не дает пустым интервалам и
+	// интервалам с долями событий (AnalyzeSamples) получать чрезмерный вес. Редкие
+	// всплески с большим количеством событий получают малый вес и не доминируют в
+	// периодограмме разреженных рядов, и значимость пиков оценивается корректнее
+	// (Scargle 1982; VanderPlas 2018, разд. 6.1 о гетероскедастичных ошибках).
+	NoisePoisson NoiseModel = "poisson"
+)
+
+// PowerModel определяет способ вычисления мощности периодограммы
+type PowerModel string
+
+const (
+	ModelStandard     PowerModel = "standard"      // Классическая периодограмма потока событий
+	ModelFloatingMean PowerModel = "floating-mean" // Обобщенная периодограмма с плавающим средним (GLS)
+)
+
+// weekStart возвращает первый день недели: WeekStart или понедельник
+func (c PeriodConfig) weekStart() time.Weekday {
+	if c.WeekStart != nil {
+		return *c.WeekStart
+	}
+	return time.Monday
+}
+
+// now возвращает текущее время по Clock или time.Now
+func (c PeriodConfig) now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
+// maxGap возвращает допустимый разрыв непрерывного отрезка: MaxGap или 48 часов
+func (c PeriodConfig) maxGap() time.Duration {
+	if c.MaxGap > 0 {
+		return c.MaxGap
+	}
+	return 48 * time.Hour
+}
+
+// weeklyWindow возвращает окно области weekly: WeeklyWindow или значение по умолчанию
+func (c PeriodConfig) weeklyWindow() time.Duration {
+	if c.WeeklyWindow > 0 {
+		return c.WeeklyWindow
+	}
+	return defaultWeeklyWindow
+}
+
+// resolveLocation заполняет Location по Timezone, если часовой пояс задан только именем
+func (c *PeriodConfig) resolveLocation() error {
+	if c.Location != nil || c.Timezone == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %v", c.Timezone, err)
+	}
+	c.Location = loc
+	return nil
+}
+
+// clone возвращает копию конфигурации, не разделяющую с исходной срезы, карты и
+// указатели на данные. Clock и ResultSink копируются как есть.
+func (c PeriodConfig) clone() PeriodConfig {
+	if c.SpectrumScopes != nil {
+		c.SpectrumScopes = append([]string(nil), c.SpectrumScopes...)
+	}
+	if c.ExcludePeriods != nil {
+		c.ExcludePeriods = append([]float64(nil), c.ExcludePeriods...)
+	}
+	if c.ScopeNumPeriods != nil {
+		limits := make(map[string]int, len(c.ScopeNumPeriods))
+		for scope, n := range c.ScopeNumPeriods {
+			limits[scope] = n
+		}
+		c.ScopeNumPeriods = limits
+	}
+	if c.ScopePeriodRanges != nil {
+		ranges := make(map[string]PeriodRange, len(c.ScopePeriodRanges))
+		for scope, r := range c.ScopePeriodRanges {
+			ranges[scope] = r
+		}
+		c.ScopePeriodRanges = ranges
+	}
+	if c.WeekStart != nil {
+		weekStart := *c.WeekStart
+		c.WeekStart = &weekStart
+	}
+	if c.BusinessHours != nil {
+		bh := *c.BusinessHours
+		if bh.Weekdays != nil {
+			bh.Weekdays = append([]time.Weekday(nil), bh.Weekdays...)
+		}
+		c.BusinessHours = &bh
+	}
+	return c
+}
+
+// location возвращает часовой пояс анализа: Location или локальный пояс процесса
+func (c PeriodConfig) location() *time.Location {
+	if c.Location != nil {
+		return c.Location
+	}
+	return time.Local
+}
+
+// Названия областей анализа, используемые в ScopeResult
+const (
+	ScopeDaily             = "daily"
+	ScopeWeekly            = "weekly"
+	ScopeAllTime           = "allTime"
+	ScopeQuarterly         = "quarterly"                    // Ключ: "2023-Q1"
+	ScopeMonthly           = "monthly"                      // Ключ: "2023-06" или "June 2023"
+	ScopeWeekday           = "weekday"                      // Ключ: "Monday", "Tuesday", ...
+	ScopeRolling           = "rolling"                      // Ключ: начало окна в RFC3339
+	ScopeContinuousAll     = "continuous.allData"           // Ключ: "daily", "weekly", "allTime"
+	ScopeContinuousLongest = "continuous.longestContinuous" // Ключ: "daily", "weekly", "allTime"
+)
+
+// ScopeResult представляет результат одной области анализа
+type ScopeResult struct {
+	Scope   string         `json:"scope"`
+	Key     string         `json:"key,omitempty"`
+	Periods []PeriodResult `json:"periods"`
 }
 
 // PeriodResult представляет результат обнаружения периода
 type PeriodResult struct {
 	Period       float64 `json:"period"`       // Период в часах
+	PeriodLabel  string  `json:"periodLabel"`  // Период в естественных единицах, например "7d", "1h30m"
 	Power        float64 `json:"power"`        // Мощность сигнала
 	Significance float64 `json:"significance"` // Значимость в процентах
+
+	// PValue - вероятность получить мощность не ниже Power на этой частоте при
+	// отсутствии периодичности, см. powerPValue
+	PValue float64 `json:"pValue"`
+
+	// ZScore - превышение мощности над средней мощностью периодограммы области
+	// в стандартных отклонениях
+	ZScore float64 `json:"zScore"`
+
+	// PeakWidth - ширина пика на половине высоты (FWHM), пересчитанная из частот
+	// в часы периода. Узкий пик - устойчивый цикл, широкий - дрейф периода или
+	// короткий интервал данных
+	PeakWidth float64 `json:"peakWidth"`
+
+	// WindowContamination - отношение мощности спектрального окна (режима наблюдения,
+	// см. windowPowerFunc) на частоте пика к мощности данных. Значения около 1 и выше
+	// означают, что пик объясняется расписанием наблюдений, а не самими событиями
+	WindowContamination float64 `json:"windowContamination"`
+
+	// PeriodRatio - Period / ReferencePeriod; заполняется, если задан ReferencePeriod
+	PeriodRatio float64 `json:"periodRatio,omitempty"`
+
+	// Description - описание периода для расписаний при Describe, например
+	// "daily ~09:00" или "weekly on Mondays"; см. describePeriod
+	Description string `json:"description,omitempty"`
+
+	// Raw - исходные суммы периодограммы на частоте периода; заполняется при
+	// IncludeRawComponents
+	Raw *RawComponents `json:"raw,omitempty"`
+
+	// Rayleigh - тест Рэлея на этом периоде; заполняется для самого сильного
+	// периода областей daily и weekly
+	Rayleigh *RayleighResult `json:"rayleigh,omitempty"`
+
+	bin int // Индекс пика в сетке частот периодограммы, для RefinePeaks
+}
+
+// RawComponents - суммы по точкам периодограммы на частоте f = 1/Period при времени
+// t в часах от Epoch (или от первого события области, если Epoch не задан). Точки -
+// события или, при BinWidth, середины интервалов. Для ModelStandard мощность равна
+// (SumCos² + SumSin²) / SumSquaredWeights; ModelFloatingMean дополнительно
+// использует границы окна наблюдения (см. computeFloatingMeanPower).
+type RawComponents struct {
+	SumCos float64 `json:"sumCos"` // Σw·cos(2πft)
+	SumSin float64 `json:"sumSin"` // Σw·sin(2πft)
+	N      int     `json:"n"`      // Количество точек
+
+	SumWeights        float64 `json:"sumWeights"`        // Σw; для событий без весов равна N
+	SumSquaredWeights float64 `json:"sumSquaredWeights"` // Нормировка мощности: Σw² или сумма квадратов весов событий при BinWidth
+}
+
+// Periodogram содержит полную периодограмму области анализа
+type Periodogram struct {
+	Frequencies []float64 `json:"frequencies"` // Частоты в 1/час
+	Powers      []float64 `json:"powers"`
 }
 
 // PeriodResults содержит результаты спектрального анализа
@@ -29,24 +525,37 @@ type PeriodResults struct {
 	Weekly    []PeriodResult            `json:"weekly"`
 	AllTime   []PeriodResult            `json:"allTime"`
 	Quarterly map[string][]PeriodResult `json:"quarterly"` // Ключ: "2023-Q1"
+
+	// Weekdays заполняется только при включенном ByWeekday
+	Weekdays map[time.Weekday][]PeriodResult `json:"weekdays,omitempty"`
+
+	// Monthly заполняется только при включенном ByMonth. Ключ: "2023-06" или
+	// "June 2023" в зависимости от MonthKeyFormat
+	Monthly map[string][]PeriodResult `json:"monthly,omitempty"`
 }
 
 // DayRecord представляет агрегированные данные за день
 type DayRecord struct {
 	Date  time.Time `json:"date"`
 	Count int       `json:"count"`
+	Rate  float64   `json:"rate"` // Событий в час с учетом фактической длительности дня (23 или 25 часов при переходе на летнее время)
+
+	SmoothedCount float64 `json:"smoothedCount,omitempty"` // Скользящее среднее Count при SmoothingWindow
 }
 
 // WeekRecord представляет агрегированные данные за неделю
 type WeekRecord struct {
-	Week  time.Time `json:"week"` // Начало недели (понедельник)
-	Count int       `json:"count"`
+	Week    time.Time `json:"week"`    // Начало недели (день WeekStart, по умолчанию понедельник)
+	ISOWeek string    `json:"isoWeek"` // Метка ISO-недели, содержащей середину недели, например "2023-W23"
+	Count   int       `json:"count"`
+	Rate    float64   `json:"rate"` // Событий в час с учетом фактической длительности недели
 }
 
 // MonthRecord представляет агрегированные данные за месяц
 type MonthRecord struct {
 	Month time.Time `json:"month"` // Первый день месяца
 	Count int       `json:"count"`
+	Rate  float64   `json:"rate"` // Событий в час с учетом фактической длительности месяца
 }
 
 // ContinuousResult содержит результаты анализа непрерывных периодов
@@ -56,10 +565,132 @@ type ContinuousResult struct {
 	Start             time.Time     `json:"start"`
 	End               time.Time     `json:"end"`
 	RecordCount       int           `json:"recordCount"`
+
+	// AllContinuousSegments - все непрерывные отрезки данных не короче MinSegmentDays
+	// в порядке времени; самый длинный из них описан Start и End
+	AllContinuousSegments []Segment `json:"allContinuousSegments"`
+
+	// LongestContinuousRecords - метки самого длинного непрерывного периода (мс Unix)
+	// в порядке времени; заполняется при IncludeLongestContinuousRecords
+	LongestContinuousRecords []int64 `json:"longestContinuousRecords,omitempty"`
+}
+
+// Segment - непрерывный отрезок данных без разрывов длиннее MaxGap. Start и End -
+// начала первого и последнего дня отрезка (UTC), как Start и End в ContinuousResult.
+type Segment struct {
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Days        int       `json:"days"` // Количество дней с событиями
+	RecordCount int       `json:"recordCount"`
+}
+
+// BinnedSeries - ряд количества событий по интервалам BinWidth, поданный на вход
+// периодограммы области: Counts[i] относится к интервалу [Start + i·Width, Start + (i+1)·Width)
+type BinnedSeries struct {
+	Start  time.Time     `json:"start"`
+	Width  time.Duration `json:"widthNs"`
+	Counts []float64     `json:"counts"`
+}
+
+// ScopeInfo описывает область анализа для справки (команда AT scopes)
+type ScopeInfo struct {
+	Name        string        // Название области, как в ScopeResult и SpectrumScopes
+	Key         string        // Значение ключа составной области, "" - ключа нет
+	Window      time.Duration // Окно данных области при заданной конфигурации, 0 - окно не фиксировано
+	Fields      []string      // Поля PeriodConfig, включающие область или управляющие ею
+	Description string
+}
+
+// scopeRun - входные данные и результаты областей одного запуска analyze. Каждая
+// область scopeRegistry заполняет только свои поля, поэтому области могут
+// выполняться параллельно.
+type scopeRun struct {
+	detector                       *periodDetector
+	times, dailyTimes, weeklyTimes []time.Time
+
+	periods         PeriodResults
+	continuous      ContinuousResult
+	skippedQuarters map[string]int
+	rolling         []RollingResult
 }
 
+// scopeRegistry перечисляет области анализа в порядке их запуска: analyze запускает
+// detect каждой области, для которой enabled (nil - всегда) возвращает true, а
+// Scopes описывает их с окнами, вычисленными теми же функциями, что и при анализе.
+var scopeRegistry = []struct {
+	info    ScopeInfo
+	window  func(c PeriodConfig) time.Duration
+	enabled func(c PeriodConfig) bool
+	detect  func(r *scopeRun)
+}{
+	{ScopeInfo{Name: ScopeDaily, Fields: []string{"AnchorToNow", "ScopeNumPeriods", "ScopePeriodRanges"},
+		Description: "last days of data, for intraday cycles"},
+		func(PeriodConfig) time.Duration { return dailyWindow }, nil,
+		func(r *scopeRun) { r.periods.Daily = r.detector.detectScope(ScopeDaily, "", r.dailyTimes) }},
+	{ScopeInfo{Name: ScopeWeekly, Fields: []string{"WeeklyWindow", "AnchorToNow", "ScopeNumPeriods", "ScopePeriodRanges"},
+		Description: "last weeks of data, for daily and weekly cycles"},
+		PeriodConfig.weeklyWindow, nil,
+		func(r *scopeRun) { r.periods.Weekly = r.detector.detectScope(ScopeWeekly, "", r.weeklyTimes) }},
+	{ScopeInfo{Name: ScopeAllTime, Fields: []string{"ScopeNumPeriods", "ScopePeriodRanges"},
+		Description: "all data"}, nil, nil,
+		func(r *scopeRun) { r.periods.AllTime = r.detector.detectScope(ScopeAllTime, "", r.times) }},
+	{ScopeInfo{Name: ScopeQuarterly, Key: "2023-Q1", Fields: []string{"MinQuarterRecords", "Location"},
+		Description: "each calendar quarter separately; maxPeriod clamped to half the quarter"}, nil, nil,
+		func(r *scopeRun) {
+			r.periods.Quarterly, r.skippedQuarters = detectQuarterlyPeriods(r.times, r.detector)
+		}},
+	{ScopeInfo{Name: ScopeMonthly, Key: "2023-06 or June 2023", Fields: []string{"ByMonth", "MonthKeyFormat", "Location"},
+		Description: "each calendar month separately; maxPeriod clamped to half the month; disabled by default"}, nil,
+		func(c PeriodConfig) bool { return c.ByMonth },
+		func(r *scopeRun) { r.periods.Monthly = detectMonthlyPeriods(r.times, r.detector) }},
+	{ScopeInfo{Name: ScopeWeekday, Key: "Monday", Fields: []string{"ByWeekday"},
+		Description: "events of each weekday separately; disabled by default"}, nil,
+		func(c PeriodConfig) bool { return c.ByWeekday },
+		func(r *scopeRun) { r.periods.Weekdays = detectWeekdayPeriods(r.times, r.detector) }},
+	{ScopeInfo{Name: ScopeContinuousAll, Key: "daily, weekly, allTime", Fields: []string{"SkipContinuous"},
+		Description: "daily/weekly/allTime windows anchored to the end of data"}, nil,
+		func(c PeriodConfig) bool { return !c.SkipContinuous },
+		func(r *scopeRun) { detectContinuousAll(r.times, r.detector, &r.continuous) }},
+	{ScopeInfo{Name: ScopeContinuousLongest, Key: "daily, weekly, allTime", Fields: []string{"SkipContinuous", "MaxGap", "MinSegmentDays"},
+		Description: "daily/weekly/allTime windows of the longest continuous segment"}, nil,
+		func(c PeriodConfig) bool { return !c.SkipContinuous },
+		func(r *scopeRun) { detectContinuousLongest(r.times, r.detector, &r.continuous) }},
+	{ScopeInfo{Name: ScopeRolling, Key: "window start (RFC3339)", Fields: []string{"RollingWindow", "RollingStep"},
+		Description: "rolling windows tracking period drift; disabled by default"},
+		func(c PeriodConfig) time.Duration { return c.RollingWindow },
+		func(c PeriodConfig) bool { return c.RollingWindow > 0 },
+		func(r *scopeRun) { r.rolling = detectRollingPeriods(r.times, r.detector) }},
+}
+
+// Scopes возвращает описания всех областей анализа с окнами для конфигурации config
+func Scopes(config PeriodConfig) []ScopeInfo {
+	scopes := make([]ScopeInfo, len(scopeRegistry))
+	for i, entry := range scopeRegistry {
+		scopes[i] = entry.info
+		if entry.window != nil {
+			scopes[i].Window = entry.window(config)
+		}
+	}
+	return scopes
+}
+
+// RollingResult содержит периоды одного скользящего окна [Start, End)
+type RollingResult struct {
+	Start       time.Time      `json:"start"`
+	End         time.Time      `json:"end"`
+	RecordCount int            `json:"recordCount"`
+	Periods     []PeriodResult `json:"periods"`
+}
+
+// SchemaVersion - версия формата AnalysisResult. Увеличивается при каждом изменении
+// структуры выходных данных, включая поля PeriodConfig в EffectiveConfig, чтобы
+// потребители могли различать форматы.
+const SchemaVersion = 28
+
 // AnalysisResult содержит полные результаты анализа
 type AnalysisResult struct {
+	SchemaVersion int `json:"schemaVersion"` // Версия формата, см. SchemaVersion
+
 	TotalRecords int              `json:"totalRecords"`
 	StartDate    time.Time        `json:"startDate"`
 	EndDate      time.Time        `json:"endDate"`
@@ -68,6 +699,119 @@ type AnalysisResult struct {
 	Months       []MonthRecord    `json:"months"`
 	Periods      PeriodResults    `json:"periods"`
 	Continuous   ContinuousResult `json:"continuous"`
+	Warnings     []string         `json:"warnings,omitempty"` // Предупреждения, возникшие при анализе
+
+	// ExcludedRecords - количество событий, исключенных фильтром BusinessHours
+	ExcludedRecords int `json:"excludedRecords"`
+
+	// Среднее и медианное время между соседними событиями (в JSON - наносекунды).
+	// Показывают естественный шаг данных: периоды короче двух таких интервалов
+	// выше предела Найквиста, и MinPeriod стоит выбирать не меньше.
+	MeanInterArrival   time.Duration `json:"meanInterArrivalNs"`
+	MedianInterArrival time.Duration `json:"medianInterArrivalNs"`
+
+	// SamplingRegularity - регулярность шага данных от 0 до 1: единица минус
+	// коэффициент вариации интервалов между событиями, ограниченная [0, 1].
+	// Около 1 - почти равномерная сетка, около 0 - нерегулярные события, для которых
+	// периодограмма Ломба-Скаргла необходима (для пуассоновского потока CV = 1).
+	SamplingRegularity float64 `json:"samplingRegularity"`
+
+	// HourProfile - количество событий по часу суток (0-23) в Location. HourEntropy -
+	// энтропия Шеннона этого распределения в битах: 0 - все события в одном часе,
+	// log2(24) ≈ 4.585 - равномерно по суткам. Не зависит от найденных периодов и
+	// показывает выраженность суточного ритма одним числом.
+	HourProfile []int   `json:"hourProfile"`
+	HourEntropy float64 `json:"hourEntropy"`
+
+	// ActivityMatrix - количество событий по дню недели и часу суток в Location:
+	// ActivityMatrix[weekday][hour], строки индексируются time.Weekday (0 - воскресенье).
+	// Готовая матрица 7×24 для тепловой карты активности.
+	ActivityMatrix [7][24]int `json:"activityMatrix"`
+
+	// EffectiveConfig - конфигурация, с которой фактически выполнен анализ, после
+	// подстановки значений по умолчанию; это копия, не разделяющая данные с конфигурацией
+	// вызывающего. Пригодна как файл для -config повторного запуска: часовой пояс
+	// сохраняется по имени в Timezone, а Clock и ResultSink не сериализуются.
+	EffectiveConfig PeriodConfig `json:"effectiveConfig"`
+
+	AnalysisDurationMs int64 `json:"analysisDurationMs"` // Длительность анализа в миллисекундах
+
+	// Spectra заполняется для областей из SpectrumScopes; при SpectrumPreviewBins
+	// содержит уменьшенные спектры.
+	// Ключ: название области, для составных областей - "quarterly/2023-Q1" и т.п.
+	Spectra map[string]Periodogram `json:"spectra,omitempty"`
+
+	// ScopeSamples заполняется при IncludeScopeSamples. Ключ: "daily", "weekly"
+	ScopeSamples map[string][]int64 `json:"scopeSamples,omitempty"`
+
+	// CumulativeDays заполняется при Cumulative: Count каждого дня - количество
+	// событий с начала данных по этот день включительно
+	CumulativeDays []DayRecord `json:"cumulativeDays,omitempty"`
+
+	// Rolling заполняется при RollingWindow > 0: периоды скользящих окон по порядку
+	Rolling []RollingResult `json:"rolling,omitempty"`
+
+	// BinnedSeries заполняется при BinWidth > 0 и IncludeBinnedSeries. Ключи - как в Spectra
+	BinnedSeries map[string]BinnedSeries `json:"binnedSeries,omitempty"`
+
+	// SkippedQuarters - кварталы, пропущенные из-за MinQuarterRecords, с количеством
+	// событий в каждом. Ключ: "2023-Q1"
+	SkippedQuarters map[string]int `json:"skippedQuarters,omitempty"`
+
+	// EffectivePeriodRanges - фактический диапазон периодов каждой области после
+	// ScopePeriodRanges, ограничения длительностью данных и BinWidth. Ключи - как в Spectra.
+	// Min >= Max означает, что ограничения не оставили периодов и область не анализировалась.
+	EffectivePeriodRanges map[string]PeriodRange `json:"effectivePeriodRanges,omitempty"`
+
+	// Fundamental заполняется при Fundamental: период области allTime, лучше всего
+	// объясняющий данные с учетом гармоник. Кандидаты - fundamentalCandidates самых
+	// мощных пиков allTime, поэтому основной период может отсутствовать в
+	// Periods.AllTime, если его гармоники мощнее. Каждый кандидат с частотой f оценивается
+	// гармонической гребенкой Σ P(k·f)/k по k = 1..fundamentalHarmonics, где P(k·f) -
+	// наибольшая мощность вокруг k·f в пределах k половин шага сетки (погрешности
+	// частоты f, умноженной на k), поэтому пик, смещенный сеткой, оценивается по
+	// истинному максимуму. Пик 24h с
+	// гармониками 12h и 8h набирает больше изолированного пика 17h той же мощности,
+	// а веса 1/k не дают субгармонике 48h обойти 24h за счет тех же гармоник.
+	Fundamental *PeriodResult `json:"fundamental,omitempty"`
+}
+
+// MarshalJSON сериализует пустые списки периодов как [], а не null
+func (pr PeriodResults) MarshalJSON() ([]byte, error) {
+	type plain PeriodResults
+	out := plain(pr)
+	out.Daily = nonNil(out.Daily)
+	out.Weekly = nonNil(out.Weekly)
+	out.AllTime = nonNil(out.AllTime)
+	out.Quarterly = make(map[string][]PeriodResult, len(pr.Quarterly))
+	for quarter, periods := range pr.Quarterly {
+		out.Quarterly[quarter] = nonNil(periods)
+	}
+	if pr.Monthly != nil {
+		out.Monthly = make(map[string][]PeriodResult, len(pr.Monthly))
+		for month, periods := range pr.Monthly {
+			out.Monthly[month] = nonNil(periods)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// MarshalJSON сериализует пустые ряды Days, Weeks и Months как [], а не null
+func (r AnalysisResult) MarshalJSON() ([]byte, error) {
+	type plain AnalysisResult
+	out := plain(r)
+	out.Days = nonNil(out.Days)
+	out.Weeks = nonNil(out.Weeks)
+	out.Months = nonNil(out.Months)
+	return json.Marshal(out)
+}
+
+// nonNil заменяет nil пустым срезом
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
 }
 
 // DefaultPeriodConfig возвращает конфигурацию по умолчанию
@@ -77,11 +821,130 @@ func DefaultPeriodConfig() PeriodConfig {
 		MaxPeriod:      8760, // 1 год
 		NumPeriods:     5,
 		SamplesPerPeak: 5,
+
+		PeriodTolerance: DefaultPeriodTolerance,
+
+		MaxAggregationBuckets: 10000,
+		MinCycles:             2,
+		MinQuarterRecords:     50,
+		WeeklyWindow:          defaultWeeklyWindow,
+	}
+}
+
+// defaultScopePeriodRanges - диапазоны периодов daily и weekly по умолчанию, см.
+// PeriodConfig.ScopePeriodRanges и resolveScopePeriodRanges
+var defaultScopePeriodRanges = map[string]PeriodRange{
+	ScopeDaily:  {Min: 1, Max: 72},
+	ScopeWeekly: {Min: 12, Max: 336},
+}
+
+// resolveScopePeriodRanges возвращает ScopePeriodRanges с подставленными
+// defaultScopePeriodRanges для областей без собственного диапазона. Граница по
+// умолчанию подставляется, только если соответствующая общая граница совпадает с
+// DefaultPeriodConfig и не противоречит другой общей границе. Исходная карта не меняется.
+func (c PeriodConfig) resolveScopePeriodRanges() map[string]PeriodRange {
+	defaults := DefaultPeriodConfig()
+	ranges := make(map[string]PeriodRange, len(c.ScopePeriodRanges)+len(defaultScopePeriodRanges))
+	for scope, r := range c.ScopePeriodRanges {
+		ranges[scope] = r
+	}
+	for scope, def := range defaultScopePeriodRanges {
+		if _, ok := ranges[scope]; ok {
+			continue
+		}
+		var r PeriodRange
+		if c.MinPeriod == defaults.MinPeriod && def.Min < c.MaxPeriod {
+			r.Min = def.Min
+		}
+		if c.MaxPeriod == defaults.MaxPeriod && def.Max > c.MinPeriod {
+			r.Max = def.Max
+		}
+		if r != (PeriodRange{}) {
+			ranges[scope] = r
+		}
 	}
+	return ranges
 }
 
 // AnalyzeTimestamps - основная точка входа для анализа
 func AnalyzeTimestamps(timestamps []int64, config PeriodConfig) (*AnalysisResult, error) {
+	return analyze(timestamps, nil, nil, config)
+}
+
+// AnalyzeSamples выполняет анализ взвешенных событий: values[i] - значение (вес)
+// события timestamps[i], и вклад события в периодограмму пропорционален значению.
+// Например, для ряда "время, сумма заказа" периодичность определяется по объему,
+// а не по количеству заказов. Агрегации по дням, неделям и месяцам по-прежнему
+// считают количество событий.
+func AnalyzeSamples(timestamps []int64, values []float64, config PeriodConfig) (*AnalysisResult, error) {
+	if len(values) != len(timestamps) {
+		return nil, fmt.Errorf("got %d values for %d timestamps", len(values), len(timestamps))
+	}
+	for i, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("value %d is not a finite number", i)
+		}
+	}
+	return analyze(timestamps, values, nil, config)
+}
+
+// Sample - измерение с погрешностью для AnalyzeMeasurements
+type Sample struct {
+	Time  int64   `json:"time"`  // метка времени в миллисекундах Unix
+	Value float64 `json:"value"` // измеренное значение
+	Sigma float64 `json:"sigma"` // стандартная погрешность Value
+}
+
+// AnalyzeMeasurements выполняет анализ ряда измерений с погрешностями взвешенной
+// обобщенной периодограммой Ломба-Скаргла (Zechmeister & Kürster, 2009): для каждой
+// частоты модель y = a·cos(ωt) + b·sin(ωt) + c подгоняется к Value с весами 1/Sigma²,
+// и мощность - доля взвешенной дисперсии Value, объясненная синусоидой. Точные
+// измерения влияют на результат сильнее зашумленных, а периодичность одних
+// погрешностей при постоянном Value мощности не дает. В отличие от AnalyzeSamples,
+// Value - измеренная величина, а не вес события; Model для измерений не применяется.
+// Точки с неположительной или бесконечной Sigma пропускаются с предупреждением
+// в AnalysisResult.Warnings. BinWidth не поддерживается.
+func AnalyzeMeasurements(samples []Sample, config PeriodConfig) (*AnalysisResult, error) {
+	if config.BinWidth > 0 {
+		return nil, errors.New("binWidth is not supported for measurements")
+	}
+	timestamps := make([]int64, 0, len(samples))
+	values := make([]float64, 0, len(samples))
+	precisions := make([]float64, 0, len(samples))
+	skipped := 0
+	for i, s := range samples {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			return nil, fmt.Errorf("sample %d: value is not a finite number", i)
+		}
+		if math.IsNaN(s.Sigma) {
+			return nil, fmt.Errorf("sample %d: sigma is not a number", i)
+		}
+		if s.Sigma <= 0 || math.IsInf(s.Sigma, 0) {
+			skipped++
+			continue
+		}
+		timestamps = append(timestamps, s.Time)
+		values = append(values, s.Value)
+		precisions = append(precisions, 1/(s.Sigma*s.Sigma))
+	}
+	if len(samples) > 0 && skipped == len(samples) {
+		return nil, errors.New("no samples with positive finite sigma")
+	}
+
+	result, err := analyze(timestamps, values, precisions, config)
+	if err != nil {
+		return nil, err
+	}
+	if skipped > 0 {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("skipped %d of %d samples with non-positive or infinite sigma", skipped, len(samples)))
+	}
+	return result, nil
+}
+
+// analyze выполняет анализ; values == nil означает невзвешенные события. Если задан
+// precisions, values - измерения, а precisions - их веса 1/σ² (см. AnalyzeMeasurements).
+func analyze(timestamps []int64, values, precisions []float64, config PeriodConfig) (*AnalysisResult, error) {
 	if len(timestamps) == 0 {
 		return nil, errors.New("no timestamps provided")
 	}
@@ -99,37 +962,289 @@ func AnalyzeTimestamps(timestamps []int64, config PeriodConfig) (*AnalysisResult
 	if config.NumPeriods <= 0 {
 		return nil, errors.New("numPeriods must be at least 1")
 	}
+	for scope, n := range config.ScopeNumPeriods {
+		if n <= 0 {
+			return nil, fmt.Errorf("scopeNumPeriods[%q] must be at least 1", scope)
+		}
+	}
+	for scope, r := range config.ScopePeriodRanges {
+		if r.Min < 0 || r.Max < 0 || (r.Min > 0 && r.Max > 0 && r.Min >= r.Max) {
+			return nil, fmt.Errorf("scopePeriodRanges[%q] must satisfy 0 < min < max", scope)
+		}
+	}
+	if config.CumulativeSignificance < 0 || config.CumulativeSignificance > 1 {
+		return nil, errors.New("cumulativeSignificance must be between 0 and 1")
+	}
+	if config.SampleFraction < 0 || config.SampleFraction > 1 {
+		return nil, errors.New("sampleFraction must be between 0 and 1")
+	}
+	if config.SamplesPerPeak <= 0 {
+		return nil, errors.New("samplesPerPeak must be at least 1")
+	}
+	if config.MinQuarterRecords < 0 {
+		return nil, errors.New("minQuarterRecords must not be negative")
+	}
+	if config.SmoothingWindow < 0 {
+		return nil, errors.New("smoothingWindow must not be negative")
+	}
+	if config.MinProminence < 0 || config.MinProminence >= 1 {
+		return nil, errors.New("minProminence must be in range [0, 1)")
+	}
+	if config.WeekStart != nil && (*config.WeekStart < time.Sunday || *config.WeekStart > time.Saturday) {
+		return nil, errors.New("weekStart must be a valid weekday")
+	}
+	if config.PeriodTolerance < 0 || config.PeriodTolerance >= 1 {
+		return nil, errors.New("periodTolerance must be in range [0, 1)")
+	}
+	if config.Jitter < 0 {
+		return nil, errors.New("jitter must not be negative")
+	}
+	if config.Deadline < 0 {
+		return nil, errors.New("deadline must not be negative")
+	}
+	if config.MaxOperations < 0 {
+		return nil, errors.New("maxOperations must not be negative")
+	}
+	if config.ReferencePeriod < 0 {
+		return nil, errors.New("referencePeriod must not be negative")
+	}
+	for _, period := range config.ExcludePeriods {
+		if period <= 0 {
+			return nil, errors.New("excludePeriods must be positive")
+		}
+	}
+	if config.PeakNeighborhood < 0 {
+		return nil, errors.New("peakNeighborhood must not be negative")
+	}
+	if config.EdgeExclusionBins < 0 {
+		return nil, errors.New("edgeExclusionBins must not be negative")
+	}
+	if config.WeeklyWindow < 0 {
+		return nil, errors.New("weeklyWindow must not be negative")
+	}
+	if config.BinWidth < 0 {
+		return nil, errors.New("binWidth must not be negative")
+	}
+	if config.SpectrumPreviewBins < 0 {
+		return nil, errors.New("spectrumPreviewBins must not be negative")
+	}
+	if config.MaxGap < 0 || config.MinSegmentDays < 0 {
+		return nil, errors.New("maxGap and minSegmentDays must not be negative")
+	}
+	if config.RollingWindow < 0 {
+		return nil, errors.New("rollingWindow must not be negative")
+	}
+	if config.RollingWindow > 0 && (config.RollingStep <= 0 || config.RollingStep > config.RollingWindow) {
+		return nil, errors.New("rollingStep must satisfy 0 < rollingStep <= rollingWindow")
+	}
+	if config.MinCycles < 0 {
+		return nil, errors.New("minCycles must not be negative")
+	}
+	if config.Parallelism < 0 {
+		return nil, errors.New("parallelism must not be negative")
+	}
+	if config.MaxAggregationBuckets < 0 {
+		return nil, errors.New("maxAggregationBuckets must not be negative")
+	}
+	if bh := config.BusinessHours; bh != nil {
+		if bh.Start < 0 || bh.End > 24 || bh.Start >= bh.End {
+			return nil, errors.New("businessHours must satisfy 0 <= start < end <= 24")
+		}
+	}
+	switch config.Model {
+	case "", ModelStandard, ModelFloatingMean:
+	default:
+		return nil, fmt.Errorf("unknown model %q", config.Model)
+	}
+	if config.Model == "" {
+		config.Model = ModelStandard
+	}
+	switch config.MonthKeyFormat {
+	case "", MonthKeyISO, MonthKeyNamed:
+	default:
+		return nil, fmt.Errorf("unknown month key format %q", config.MonthKeyFormat)
+	}
+	if config.MonthKeyFormat == "" {
+		config.MonthKeyFormat = MonthKeyISO
+	}
+	switch config.NoiseModel {
+	case "", NoiseGaussian, NoisePoisson:
+	default:
+		return nil, fmt.Errorf("unknown noise model %q", config.NoiseModel)
+	}
+	if config.NoiseModel == "" {
+		config.NoiseModel = NoiseGaussian
+	}
+	if config.WeekStart == nil {
+		weekStart := config.weekStart()
+		config.WeekStart = &weekStart
+	}
+	if err := config.resolveLocation(); err != nil {
+		return nil, err
+	}
+	config.Timezone = ""
+	if loc := config.location(); loc != time.Local {
+		config.Timezone = loc.String()
+	}
+	config.ScopePeriodRanges = config.resolveScopePeriodRanges()
+
+	analysisStart := time.Now()
+
+	// Случайная выборка для приближенного анализа
+	sampled := len(timestamps)
+	if config.SampleFraction > 0 && config.SampleFraction < 1 {
+		timestamps, values, precisions = sampleTimestamps(timestamps, values, precisions, config.SampleFraction, config.Seed)
+		if len(timestamps) == 0 {
+			return nil, errors.New("no timestamps left after sampling; increase sampleFraction")
+		}
+	}
 
 	// Конвертация временных меток в time.Time
+	loc := config.location()
 	times := make([]time.Time, len(timestamps))
 	for i, ts := range timestamps {
-		times[i] = time.Unix(ts/1000, (ts%1000)*int64(time.Millisecond))
+		if config.AssumeSorted && i > 0 && ts < timestamps[i-1] {
+			return nil, fmt.Errorf("timestamps are not sorted: timestamp %d (%d) precedes timestamp %d (%d)",
+				i, ts, i-1, timestamps[i-1])
+		}
+		times[i] = time.Unix(ts/1000, (ts%1000)*int64(time.Millisecond)).In(loc)
+	}
+
+	// Фильтрация по рабочим часам
+	excluded := 0
+	if config.BusinessHours != nil {
+		kept := times[:0]
+		var keptValues, keptPrecisions []float64
+		for i, t := range times {
+			if config.BusinessHours.contains(t) {
+				kept = append(kept, t)
+				if values != nil {
+					keptValues = append(keptValues, values[i])
+				}
+				if precisions != nil {
+					keptPrecisions = append(keptPrecisions, precisions[i])
+				}
+			}
+		}
+		excluded = len(times) - len(kept)
+		times = kept
+		if values != nil {
+			values = keptValues
+		}
+		if precisions != nil {
+			precisions = keptPrecisions
+		}
+		if len(times) == 0 {
+			return nil, errors.New("no timestamps within business hours")
+		}
+	}
+
+	// Инициализация детектора периодов
+	detector := newPeriodDetector(config)
+	if config.Deadline > 0 {
+		detector.deadline = config.now().Add(config.Deadline)
+	}
+	if len(timestamps) < sampled {
+		detector.warnf("analyzed a random sample of %d of %d timestamps (sampleFraction %g); results are approximate",
+			len(timestamps), sampled, config.SampleFraction)
+	}
+
+	// Разнесение совпадающих меток
+	jittered := 0
+	if config.Jitter > 0 {
+		if jittered = jitterDuplicates(times, config.Jitter, config.Seed); jittered > 0 {
+			detector.warnf("jittered %d duplicate timestamps by up to ±%s", jittered, config.Jitter/2)
+		}
+	}
+	switch {
+	case precisions != nil:
+		detector.weights, detector.precisions = measurementWeights(times, values, precisions)
+	case values != nil:
+		detector.weights = sampleWeights(times, values)
+	}
+
+	// Непрерывные отрезки, скользящие окна и интервалы между событиями
+	// рассчитаны на упорядоченные метки; times - собственная копия анализа
+	if !config.AssumeSorted || jittered > 0 {
+		sort.Slice(times, func(i, j int) bool {
+			return times[i].Before(times[j])
+		})
 	}
 
 	// Определение временного диапазона
 	startDate, endDate := findDateRange(times)
 
-	// Агрегация данных
-	days := aggregateByDay(times)
-	weeks := aggregateByWeek(times)
-	months := aggregateByMonth(times)
+	// Отказ от заведомо неподъемного расчета до начала работы
+	if config.BinWidth > 0 {
+		if bins := float64(endDate.Sub(startDate)) / float64(config.BinWidth); bins > maxBins {
+			return nil, fmt.Errorf("binWidth %s splits the %s of data into %.0f intervals, more than %d; increase binWidth",
+				config.BinWidth, humanizeHours(endDate.Sub(startDate).Hours()), bins, maxBins)
+		}
+	}
+	if config.RollingWindow > 0 {
+		if n := rollingWindowCount(endDate.Sub(startDate), config.RollingWindow, config.RollingStep); n > maxRollingWindows {
+			return nil, fmt.Errorf("rollingStep %s gives %d rolling windows, more than %d; increase rollingStep",
+				config.RollingStep, n, maxRollingWindows)
+		}
+	}
+	if config.MaxOperations > 0 {
+		ops := detector.estimateOperations(len(times), endDate.Sub(startDate).Hours())
+		if ops > config.MaxOperations {
+			return nil, fmt.Errorf("estimated %d periodogram operations exceed maxOperations %d; "+
+				"reduce samplesPerPeak, narrow the period range or analyze less data", ops, config.MaxOperations)
+		}
+	}
 
-	// Инициализация детектора периодов
-	detector := newPeriodDetector(config)
+	// Агрегация данных
+	var days []DayRecord
+	var weeks []WeekRecord
+	var months []MonthRecord
+	if !config.SkipAggregation {
+		var sparse bool
+		if days, sparse = aggregateByDay(times, config.MaxAggregationBuckets); sparse {
+			detector.warnf("daily series exceeds %d buckets; empty days are omitted", config.MaxAggregationBuckets)
+		}
+		if config.SmoothingWindow > 0 {
+			smoothDays(days, config.SmoothingWindow)
+		}
+		weeks = aggregateByWeek(times, config.weekStart())
+		if months, sparse = aggregateByMonth(times, config.MaxAggregationBuckets); sparse {
+			detector.warnf("monthly series exceeds %d buckets; empty months are omitted", config.MaxAggregationBuckets)
+		}
+	}
 
 	// Спектральный анализ
-	periods := PeriodResults{
-		Daily:     detector.detect(filterByTimeRange(times, endDate, 72*time.Hour)),
-		Weekly:    detector.detect(filterByTimeRange(times, endDate, 336*time.Hour)),
-		AllTime:   detector.detect(times),
-		Quarterly: detectQuarterlyPeriods(times, detector),
+	windowEnd := endDate
+	if config.AnchorToNow {
+		windowEnd = config.now()
+	}
+	dailyTimes := filterByTimeRange(times, windowEnd, dailyWindow)
+	weeklyTimes := filterByTimeRange(times, windowEnd, config.weeklyWindow())
+	if start, end := findDateRange(weeklyTimes); end.Sub(start) < weeklyMinWeeks*week {
+		detector.warnf("weekly window covers %s of data, fewer than %d weeks; weekly periods may be poorly resolved",
+			humanizeHours(end.Sub(start).Hours()), weeklyMinWeeks)
+	}
+	// Области анализа и их порядок задает scopeRegistry
+	run := &scopeRun{detector: detector, times: times, dailyTimes: dailyTimes, weeklyTimes: weeklyTimes}
+	var tasks []func()
+	for _, entry := range scopeRegistry {
+		if entry.enabled == nil || entry.enabled(config) {
+			detect := entry.detect
+			tasks = append(tasks, func() { detect(run) })
+		}
+	}
+	runTasks(tasks, config.Parallelism)
+	periods, continuous, rolling, skippedQuarters := run.periods, run.continuous, run.rolling, run.skippedQuarters
+	rayleighForTop(periods.Daily, dailyTimes)
+	rayleighForTop(periods.Weekly, weeklyTimes)
+	if len(detector.skipped) > 0 {
+		detector.warnf("deadline of %s exceeded; skipped scopes: %s", config.Deadline, strings.Join(detector.skipped, ", "))
 	}
-
-	// Анализ непрерывных периодов
-	continuous := analyzeContinuousPeriods(times, detector)
 
 	// Формирование результата
 	result := &AnalysisResult{
+		SchemaVersion: SchemaVersion,
+
 		TotalRecords: len(times),
 		StartDate:    startDate,
 		EndDate:      endDate,
@@ -138,140 +1253,1310 @@ func AnalyzeTimestamps(timestamps []int64, config PeriodConfig) (*AnalysisResult
 		Months:       months,
 		Periods:      periods,
 		Continuous:   continuous,
+		Warnings:     detector.warnings,
+		Spectra:      detector.spectra,
+
+		BinnedSeries: detector.binned,
+		Fundamental:  detector.fundamental,
+
+		EffectivePeriodRanges: detector.ranges,
+
+		ExcludedRecords: excluded,
+		EffectiveConfig: config.clone(),
+		Rolling:         rolling,
+		SkippedQuarters: skippedQuarters,
+	}
+	result.MeanInterArrival, result.MedianInterArrival, result.SamplingRegularity = interArrivalStats(times)
+	result.HourProfile = hourProfile(times)
+	result.HourEntropy = shannonEntropy(result.HourProfile)
+	result.ActivityMatrix = activityMatrix(times)
+	if config.IncludeScopeSamples {
+		result.ScopeSamples = map[string][]int64{
+			ScopeDaily:  toUnixMillis(dailyTimes),
+			ScopeWeekly: toUnixMillis(weeklyTimes),
+		}
+	}
+	if config.Cumulative {
+		result.CumulativeDays = cumulativeDays(days)
 	}
+	result.AnalysisDurationMs = time.Since(analysisStart).Milliseconds()
 
 	return result, nil
 }
 
+// Окна областей Daily и Weekly, отсчитываемые от последней временной метки
+const (
+	dailyWindow         = 72 * time.Hour
+	defaultWeeklyWindow = 4 * week
+
+	week = 7 * 24 * time.Hour
+
+	// weeklyMinWeeks - минимальный охват данных области weekly в неделях,
+	// при котором недельный период выделяется надежно
+	weeklyMinWeeks = 3
+)
+
+// AnalyzeGroups выполняет анализ отдельно для каждой группы временных меток
+func AnalyzeGroups(groups map[string][]int64, config PeriodConfig) (map[string]*AnalysisResult, error) {
+	results := make(map[string]*AnalysisResult, len(groups))
+
+	for _, group := range sortedKeys(groups) {
+		result, err := AnalyzeTimestamps(groups[group], config)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %w", group, err)
+		}
+		results[group] = result
+	}
+
+	return results, nil
+}
+
+// Границы размера сетки частот периодограммы
+const (
+	minFrequencies = 100
+	maxFrequencies = 10000
+)
+
+// maxBins - наибольшее количество интервалов BinWidth на длительности данных.
+// Полный ряд интервалов (NoisePoisson, IncludeBinnedSeries) занимает 8 байт на
+// интервал, и слишком узкий BinWidth на длинных данных исчерпал бы память.
+const maxBins = 1 << 22
+
+// spectrumBuffers содержит буферы частот и мощностей периодограммы. Они нужны только
+// на время detect, поэтому переиспользуются между областями, кварталами и запросами,
+// чтобы не создавать короткоживущий мусор для каждой периодограммы.
+type spectrumBuffers struct {
+	freqs  []float64
+	powers []float64
+}
+
+var spectrumPool = sync.Pool{
+	New: func() interface{} {
+		return &spectrumBuffers{
+			freqs:  make([]float64, maxFrequencies),
+			powers: make([]float64, maxFrequencies),
+		}
+	},
+}
+
+// resize возвращает буферы длины n, при необходимости увеличивая их
+func (b *spectrumBuffers) resize(n int) ([]float64, []float64) {
+	if cap(b.freqs) < n {
+		b.freqs = make([]float64, n)
+		b.powers = make([]float64, n)
+	}
+	return b.freqs[:n], b.powers[:n]
+}
+
 // periodDetector реализует алгоритм Ломба-Скаргла
 type periodDetector struct {
 	config PeriodConfig
+
+	// mu защищает warnings, spectra, binned, ranges и skipped при параллельном анализе областей
+	mu       sync.Mutex
+	warnings []string
+	spectra  map[string]Periodogram
+	binned   map[string]BinnedSeries
+	ranges   map[string]PeriodRange
+
+	// deadline - момент, после которого области пропускаются (нулевой - без ограничения);
+	// skipped - названия пропущенных областей
+	deadline time.Time
+	skipped  []string
+
+	// weights - веса событий по моменту времени (UnixNano) для AnalyzeSamples;
+	// nil - все события имеют единичный вес. Если задан precisions, weights -
+	// измерения AnalyzeMeasurements, а precisions - их веса 1/σ².
+	weights    map[int64]float64
+	precisions map[int64]float64
+
+	fundamental *PeriodResult // Основной период allTime при Fundamental
+}
+
+func newPeriodDetector(config PeriodConfig) *periodDetector {
+	return &periodDetector{config: config}
+}
+
+// warnf добавляет предупреждение к результату анализа
+func (pd *periodDetector) warnf(format string, args ...interface{}) {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	pd.warnings = append(pd.warnings, fmt.Sprintf(format, args...))
+}
+
+// skip отмечает область как пропущенную из-за истечения Deadline
+func (pd *periodDetector) skip(name string) {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	pd.skipped = append(pd.skipped, name)
+}
+
+var (
+	// errZeroSpan означает, что все метки области совпадают и периодограмма не определена
+	errZeroSpan = errors.New("zero time span")
+
+	// errDeadline означает, что расчет периодограммы прерван по истечении Deadline
+	errDeadline = errors.New("deadline exceeded")
+)
+
+// detect выполняет обнаружение не более numPeriods периодов в диапазоне [minPeriod, maxPeriod] часов
+// Если spectrum не nil, в него копируется вычисленная периодограмма.
+// Возвращает errZeroSpan, если все метки совпадают, и errDeadline, если расчет прерван.
+func (pd *periodDetector) detect(name string, times []time.Time, minPeriod, maxPeriod float64, numPeriods int, spectrum *Periodogram) ([]PeriodResult, error) {
+	if len(times) < 4 {
+		return nil, nil
+	}
+	if minPeriod >= maxPeriod {
+		pd.collapsedRange(name, minPeriod, maxPeriod)
+		return nil, nil
+	}
+
+	// Конвертация в часы относительно начала отсчета
+	anchor := pd.config.Epoch
+	if anchor.IsZero() {
+		anchor, _ = findDateRange(times)
+	}
+	timesHours := convertToHours(times, anchor)
+	span := hoursSpan(timesHours)
+
+	// Веса событий области для AnalyzeSamples или измерения и их веса для AnalyzeMeasurements
+	var weights, precisions []float64
+	if pd.weights != nil {
+		weights = make([]float64, len(times))
+		for i, t := range times {
+			weights[i] = pd.weights[t.UnixNano()]
+		}
+	}
+	if pd.precisions != nil {
+		precisions = make([]float64, len(times))
+		for i, t := range times {
+			precisions[i] = pd.precisions[t.UnixNano()]
+		}
+	}
+
+	// Группировка событий в интервалы BinWidth; периоды короче двух интервалов
+	// неразрешимы (предел Найквиста) и дали бы ложные пики
+	var wsq float64
+	if pd.config.BinWidth > 0 {
+		minPeriod = math.Max(minPeriod, 2*pd.config.BinWidth.Hours())
+		if minPeriod >= maxPeriod {
+			pd.collapsedRange(name, minPeriod, maxPeriod)
+			return nil, nil
+		}
+		var series *BinnedSeries
+		dense := pd.config.NoiseModel == NoisePoisson || pd.config.IncludeBinnedSeries
+		timesHours, weights, wsq, series = binEvents(timesHours, weights, pd.config.BinWidth, anchor, dense)
+		if pd.config.NoiseModel == NoisePoisson {
+			// Количества всех интервалов - измерения с весами 1/max(count, 1)
+			width := pd.config.BinWidth.Hours()
+			first := series.Start.Sub(anchor).Hours()
+			timesHours = make([]float64, len(series.Counts))
+			weights = make([]float64, len(series.Counts))
+			precisions = make([]float64, len(series.Counts))
+			for i, count := range series.Counts {
+				timesHours[i] = first + (float64(i)+0.5)*width
+				weights[i] = count
+				precisions[i] = 1 / math.Max(count, 1)
+			}
+			wsq = 0
+		}
+		if pd.config.IncludeBinnedSeries {
+			pd.mu.Lock()
+			if pd.binned == nil {
+				pd.binned = make(map[string]BinnedSeries)
+			}
+			pd.binned[name] = *series
+			pd.mu.Unlock()
+		}
+	}
+
+	pd.setRange(name, minPeriod, maxPeriod)
+
+	// Вычисление периодограммы в переиспользуемых буферах
+	buf := spectrumPool.Get().(*spectrumBuffers)
+	defer spectrumPool.Put(buf)
+	freqs, powers := pd.computePeriodogram(timesHours, weights, precisions, wsq, minPeriod, maxPeriod, buf)
+
+	// Пустая периодограмма: расчет прерван по сроку или нулевая длительность
+	if freqs == nil {
+		if pd.expired() {
+			return nil, errDeadline
+		}
+		return nil, errZeroSpan
+	}
+
+	// Буферы возвращаются в пул, поэтому спектр сохраняем копией
+	if spectrum != nil {
+		spectrum.Frequencies = append([]float64(nil), freqs...)
+		spectrum.Powers = append([]float64(nil), powers...)
+	}
+
+	// Уточнение пиков между отсчетами сетки (нормировка - по спектру до маски
+	// ExcludePeriods) и сравнение уточненной мощности со спектральным окном
+	stats := newSpectrumStats(powers)
+	finish := func(periods []PeriodResult) []PeriodResult {
+		if pd.config.RefinePeaks {
+			if power := pd.powerFunc(timesHours, weights, precisions, wsq); power != nil {
+				pd.refinePeaks(periods, freqs, power, stats)
+			}
+		}
+		if window := pd.windowPowerFunc(times, anchor, timesHours, weights, precisions, wsq); window != nil {
+			for i, p := range periods {
+				if p.Power > 0 {
+					periods[i].WindowContamination = window(1/p.Period) / p.Power
+				}
+			}
+		}
+		if pd.config.Describe {
+			tolerance := effectiveTolerance(pd.config.PeriodTolerance)
+			for i, p := range periods {
+				periods[i].Description = describePeriod(p.Period, times, pd.config.location(), tolerance)
+			}
+		}
+		if pd.config.IncludeRawComponents {
+			for i, p := range periods {
+				periods[i].Raw = rawComponents(timesHours, weights, precisions, wsq, 1/p.Period)
+			}
+		}
+		return periods
+	}
+
+	// Основной период выбирается среди большего числа пиков, чем возвращается:
+	// гармоники часто мощнее самого основного периода
+	fundamental := name == ScopeAllTime && pd.config.Fundamental
+	if pd.config.MinCycles <= 0 && !fundamental {
+		// Поиск значимых пиков
+		return finish(pd.findSignificantPeaks(freqs, powers, numPeriods)), nil
+	}
+
+	// Периоды, не укладывающиеся MinCycles раз в данные, отбрасываются до
+	// ограничения количества, чтобы их место заняли следующие по мощности
+	limit := math.Inf(1)
+	if pd.config.MinCycles > 0 {
+		limit = span / pd.config.MinCycles
+	}
+	var periods, rejected []PeriodResult
+	for _, p := range pd.findSignificantPeaks(freqs, powers, 0) {
+		if p.Period > limit {
+			rejected = append(rejected, p)
+		} else {
+			periods = append(periods, p)
+		}
+	}
+	if len(rejected) > 0 {
+		labels := make([]string, len(rejected))
+		for i, p := range rejected {
+			labels[i] = p.PeriodLabel
+		}
+		pd.warnf("%s: dropped periods longer than %s (fewer than %g cycles in data): %s",
+			name, humanizeHours(limit), pd.config.MinCycles, strings.Join(labels, ", "))
+	}
+	// selectPeriods возвращает начало periods, и finish обновляет его на месте,
+	// поэтому возвращаемые кандидаты совпадают с результатами области
+	selected := finish(pd.selectPeriods(periods, numPeriods))
+	if fundamental {
+		if power := pd.powerFunc(timesHours, weights, precisions, wsq); power != nil {
+			if len(periods) > fundamentalCandidates {
+				periods = periods[:fundamentalCandidates]
+			}
+			if i := findFundamental(periods, freqs, power); i >= 0 {
+				// Кандидат за пределами возвращаемых периодов еще не прошел finish
+				result := periods[i]
+				if i >= len(selected) {
+					result = finish([]PeriodResult{result})[0]
+				}
+				pd.fundamental = &result
+			}
+		}
+	}
+	return selected, nil
+}
+
+// setRange записывает фактический диапазон периодов области в EffectivePeriodRanges
+func (pd *periodDetector) setRange(name string, minPeriod, maxPeriod float64) {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	if pd.ranges == nil {
+		pd.ranges = make(map[string]PeriodRange)
+	}
+	pd.ranges[name] = PeriodRange{Min: minPeriod, Max: maxPeriod}
+}
+
+// collapsedRange отмечает область, в которой ограничения длительностью данных или
+// BinWidth не оставили ни одного периода: диапазон записывается как есть (Min >= Max)
+// с предупреждением, чтобы область не пропадала из результата без объяснения
+func (pd *periodDetector) collapsedRange(name string, minPeriod, maxPeriod float64) {
+	pd.setRange(name, minPeriod, maxPeriod)
+	pd.warnf("%s: period range collapsed to [%g, %g] hours by the data span or binWidth; periods not detected",
+		name, minPeriod, maxPeriod)
+}
+
+// binEvents группирует события (в часах от anchor) в интервалы width. Возвращает
+// середины непустых интервалов, их веса (количество или сумму весов событий), сумму
+// квадратов весов событий для нормировки и, при dense, полный ряд интервалов, включая
+// пустые (иначе nil). Длина полного ряда ограничена maxBins проверкой в analyze.
+func binEvents(times, weights []float64, width time.Duration, anchor time.Time, dense bool) (centers, binWeights []float64, wsq float64, series *BinnedSeries) {
+	w := width.Hours()
+	sums := make(map[int64]float64)
+	minBin, maxBin := int64(math.MaxInt64), int64(math.MinInt64)
+	for i, t := range times {
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		bin := int64(math.Floor(t / w))
+		sums[bin] += weight
+		wsq += weight * weight
+		if bin < minBin {
+			minBin = bin
+		}
+		if bin > maxBin {
+			maxBin = bin
+		}
+	}
+
+	if dense {
+		series = &BinnedSeries{
+			Start:  anchor.Add(time.Duration(minBin) * width),
+			Width:  width,
+			Counts: make([]float64, maxBin-minBin+1),
+		}
+		for bin, sum := range sums {
+			series.Counts[bin-minBin] = sum
+		}
+	}
+
+	bins := make([]int64, 0, len(sums))
+	for bin, sum := range sums {
+		if sum != 0 {
+			bins = append(bins, bin)
+		}
+	}
+	sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+	centers = make([]float64, len(bins))
+	binWeights = make([]float64, len(bins))
+	for i, bin := range bins {
+		centers[i] = (float64(bin) + 0.5) * w
+		binWeights[i] = sums[bin]
+	}
+	return centers, binWeights, wsq, series
+}
+
+// hoursSpan возвращает длительность интервала, занятого отметками в часах
+func hoursSpan(times []float64) float64 {
+	t0, t1 := times[0], times[0]
+	for _, t := range times {
+		t0 = math.Min(t0, t)
+		t1 = math.Max(t1, t)
+	}
+	return t1 - t0
+}
+
+// detectScope выполняет обнаружение периодов для области и отправляет результат в ResultSink
+func (pd *periodDetector) detectScope(scope, key string, times []time.Time) []PeriodResult {
+	name := scope
+	if key != "" {
+		name = scope + "/" + key
+	}
+	if pd.expired() {
+		pd.skip(name)
+		return nil
+	}
+
+	minPeriod, maxPeriod := pd.scopePeriodRange(scope, key, times)
+
+	var spectrum *Periodogram
+	if pd.keepsSpectrum(scope) {
+		spectrum = &Periodogram{}
+	}
+
+	periods, err := pd.detect(name, times, minPeriod, maxPeriod, pd.numPeriods(scope, name), spectrum)
+	switch {
+	case errors.Is(err, errZeroSpan):
+		pd.warnf("%s: zero time span, all %d timestamps coincide; periods not detected", name, len(times))
+	case errors.Is(err, errDeadline):
+		// Расчет прерван по сроку: неполная периодограмма не используется
+		pd.skip(name)
+		return nil
+	}
+
+	if spectrum != nil && len(spectrum.Frequencies) > 0 {
+		pd.mu.Lock()
+		if pd.spectra == nil {
+			pd.spectra = make(map[string]Periodogram)
+		}
+		if pd.config.SpectrumPreviewBins > 0 {
+			*spectrum = downsampleSpectrum(*spectrum, pd.config.SpectrumPreviewBins)
+		}
+		pd.spectra[name] = *spectrum
+		pd.mu.Unlock()
+	}
+	if pd.config.ResultSink != nil {
+		pd.config.ResultSink <- ScopeResult{Scope: scope, Key: key, Periods: periods}
+	}
+	return periods
+}
+
+// downsampleSpectrum уменьшает периодограмму до bins отсчетов выбором максимума
+// в каждой группе подряд идущих частот
+func downsampleSpectrum(spectrum Periodogram, bins int) Periodogram {
+	n := len(spectrum.Frequencies)
+	if n <= bins {
+		return spectrum
+	}
+
+	preview := Periodogram{
+		Frequencies: make([]float64, bins),
+		Powers:      make([]float64, bins),
+	}
+	for b := 0; b < bins; b++ {
+		from, to := b*n/bins, (b+1)*n/bins
+		best := from
+		for i := from + 1; i < to; i++ {
+			if spectrum.Powers[i] > spectrum.Powers[best] {
+				best = i
+			}
+		}
+		preview.Frequencies[b] = spectrum.Frequencies[best]
+		preview.Powers[b] = spectrum.Powers[best]
+	}
+	return preview
+}
+
+// numPeriods возвращает количество периодов для области с учетом ScopeNumPeriods
+func (pd *periodDetector) numPeriods(scope, name string) int {
+	if n, ok := pd.config.ScopeNumPeriods[name]; ok {
+		return n
+	}
+	if n, ok := pd.config.ScopeNumPeriods[scope]; ok {
+		return n
+	}
+	return pd.config.NumPeriods
+}
+
+// expired проверяет, истек ли срок Deadline по часам Clock
+func (pd *periodDetector) expired() bool {
+	return !pd.deadline.IsZero() && pd.config.now().After(pd.deadline)
+}
+
+// keepsSpectrum проверяет, нужно ли сохранять периодограмму области
+func (pd *periodDetector) keepsSpectrum(scope string) bool {
+	for _, s := range pd.config.SpectrumScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredPeriodRange возвращает диапазон периодов области из MinPeriod, MaxPeriod
+// и ScopePeriodRanges без ограничений по длительности данных
+func (pd *periodDetector) configuredPeriodRange(scope, key string) (minPeriod, maxPeriod float64) {
+	minPeriod, maxPeriod = pd.config.MinPeriod, pd.config.MaxPeriod
+
+	// Переопределение ScopePeriodRanges: полное имя области имеет приоритет
+	r, ok := pd.config.ScopePeriodRanges[scope+"/"+key]
+	if !ok {
+		r = pd.config.ScopePeriodRanges[scope]
+	}
+	if r.Min > 0 {
+		minPeriod = r.Min
+	}
+	if r.Max > 0 {
+		maxPeriod = r.Max
+	}
+	return minPeriod, maxPeriod
+}
+
+// scopePeriodRange возвращает диапазон периодов, применимый к области анализа
+func (pd *periodDetector) scopePeriodRange(scope, key string, times []time.Time) (minPeriod, maxPeriod float64) {
+	minPeriod, maxPeriod = pd.configuredPeriodRange(scope, key)
+
+	// Квартал охватывает не более ~2160 часов, а месяц - не более 744, и периоды
+	// длиннее половины их длительности не разрешимы, поэтому ограничиваем maxPeriod
+	start, end := findDateRange(times)
+	span := end.Sub(start).Hours()
+	if scope == ScopeQuarterly || scope == ScopeMonthly {
+		limit := span / 2
+		if limit < maxPeriod {
+			pd.warnf("%s %s: maxPeriod clamped from %g to %g hours (half of the scope span)", scope, key, maxPeriod, limit)
+			maxPeriod = limit
+		}
+	}
+
+	// То же для остальных областей: пик на периоде, сравнимом с длительностью данных,
+	// отражает только общий тренд (например, "годовой" период на 100 часах данных),
+	// а такие периоды отбросил бы MinCycles. Ограничение записывается в
+	// EffectivePeriodRanges без предупреждения, так как окна daily и weekly
+	// короче своих диапазонов по умолчанию.
+	if limit := span / math.Max(pd.config.MinCycles, 2); limit < maxPeriod {
+		maxPeriod = limit
+	}
+
+	return minPeriod, maxPeriod
+}
+
+// computePeriodogram вычисляет периодограмму Ломба-Скаргла
+// weights - веса событий (nil - все веса равны 1). wsq - сумма квадратов весов
+// исходных событий для нормировки, если times - интервалы BinWidth, а не события;
+// 0 - сумма вычисляется по weights. Если задан precisions, times - моменты измерений,
+// weights - их значения, а precisions - веса 1/σ² (см. measurementPowerFunc).
+func (pd *periodDetector) computePeriodogram(times, weights, precisions []float64, wsq, minPeriod, maxPeriod float64, buf *spectrumBuffers) ([]float64, []float64) {
+	minFreq := 1 / maxPeriod
+	maxFreq := 1 / minPeriod
+
+	// Рассчитываем количество частот
+	t0, t1 := times[0], times[0]
+	for _, t := range times {
+		t0 = math.Min(t0, t)
+		t1 = math.Max(t1, t)
+	}
+	T := t1 - t0
+	if T <= 0 {
+		// Нулевая длительность: сетка частот не определена, см. errZeroSpan
+		return nil, nil
+	}
+
+	freqs, powers := pd.frequencyGrid(T, minFreq, maxFreq, buf)
+
+	power := pd.powerFunc(times, weights, precisions, wsq)
+	if power == nil {
+		for i := range powers {
+			powers[i] = 0
+		}
+		return freqs, powers
+	}
+
+	// Вычисляем мощность для каждой частоты, периодически проверяя срок
+	for i, f := range freqs {
+		if i%16 == 0 && pd.expired() {
+			return nil, nil
+		}
+		powers[i] = power(f)
+	}
+
+	return freqs, powers
+}
+
+// powerFunc возвращает мощность на частоте freq для событий times с весами weights
+// по модели Model (параметры - как в computePeriodogram). Возвращает nil, если
+// сумма квадратов весов равна нулю и мощность не определена.
+func (pd *periodDetector) powerFunc(times, weights, precisions []float64, wsq float64) func(freq float64) float64 {
+	if precisions != nil {
+		return measurementPowerFunc(times, weights, precisions)
+	}
+
+	// Сумма весов и сумма их квадратов для нормировки
+	W, WSq := float64(len(times)), float64(len(times))
+	if weights != nil {
+		W, WSq = 0, 0
+		for _, w := range weights {
+			W += w
+			WSq += w * w
+		}
+		if WSq == 0 {
+			return nil
+		}
+		if wsq > 0 {
+			WSq = wsq
+		}
+	}
+
+	if pd.config.Model == ModelFloatingMean {
+		t0, t1 := times[0], times[0]
+		for _, t := range times {
+			t0 = math.Min(t0, t)
+			t1 = math.Max(t1, t)
+		}
+		return func(freq float64) float64 {
+			return pd.computeFloatingMeanPower(times, weights, freq, t0, t1, W, WSq)
+		}
+	}
+	return func(freq float64) float64 {
+		return pd.computePower(times, weights, freq, WSq)
+	}
+}
+
+// windowPowerFunc возвращает мощность спектрального окна на частоте freq: мощность,
+// которую дал бы один только режим наблюдения при постоянной интенсивности, в той же
+// нормировке, что и powerFunc. Для событий без весов окно - отрезки
+// findContinuousSegments (разрывы длиннее MaxGap считаются ненаблюдаемыми), и
+// мощность равна N·|∫окно e^(iωt)dt|² / T², где T - суммарная длительность отрезков.
+// Для взвешенных событий и интервалов BinWidth окно - сами моменты отсчетов со
+// средним весом. Возвращает nil, если окно не определено, и для измерений
+// (precisions не nil): их модель с плавающим средним подгоняется по самим отсчетам.
+func (pd *periodDetector) windowPowerFunc(times []time.Time, anchor time.Time, points, weights, precisions []float64, wsq float64) func(freq float64) float64 {
+	if precisions != nil {
+		return nil
+	}
+	if weights == nil {
+		segments := findContinuousSegments(times, pd.config.maxGap())
+		bounds := make([][2]float64, len(segments))
+		observed := 0.0
+		for i, s := range segments {
+			bounds[i] = [2]float64{s.Start.Sub(anchor).Hours(), s.End.Add(24 * time.Hour).Sub(anchor).Hours()}
+			observed += bounds[i][1] - bounds[i][0]
+		}
+		if observed <= 0 {
+			return nil
+		}
+		n := float64(len(times))
+		return func(freq float64) float64 {
+			omega := 2 * math.Pi * freq
+			re, im := 0.0, 0.0
+			for _, b := range bounds {
+				re += (math.Sin(omega*b[1]) - math.Sin(omega*b[0])) / omega
+				im += (math.Cos(omega*b[0]) - math.Cos(omega*b[1])) / omega
+			}
+			return n * (re*re + im*im) / (observed * observed)
+		}
+	}
+
+	W, WSq := 0.0, 0.0
+	for _, w := range weights {
+		W += w
+		WSq += w * w
+	}
+	if WSq == 0 {
+		return nil
+	}
+	if wsq > 0 {
+		WSq = wsq
+	}
+	mean := W / float64(len(weights))
+	return func(freq float64) float64 {
+		sumCos, sumSin := phaseSums(points, nil, 2*math.Pi*freq)
+		return mean * mean * (sumCos*sumCos + sumSin*sumSin) / WSq
+	}
+}
+
+// frequencyGrid заполняет сетку частот [minFreq, maxFreq] для длительности T:
+// равномерную или, при Adaptive, из логарифмических полос
+func (pd *periodDetector) frequencyGrid(T, minFreq, maxFreq float64, buf *spectrumBuffers) ([]float64, []float64) {
+	if pd.config.Adaptive {
+		return pd.adaptiveFrequencies(T, minFreq, maxFreq, buf)
+	}
+
+	nFreqs := pd.frequencyCount(T, minFreq, maxFreq)
+	freqs, powers := buf.resize(nFreqs)
+
+	// Шаг по частоте
+	df := (maxFreq - minFreq) / float64(nFreqs-1)
+	for i := range freqs {
+		freqs[i] = minFreq + float64(i)*df
+	}
+	return freqs, powers
+}
+
+// frequencyCount возвращает количество частот для полосы [minFreq, maxFreq] при длительности T
+func (pd *periodDetector) frequencyCount(T, minFreq, maxFreq float64) int {
+	// Ограничиваем количество частот до преобразования в int,
+	// чтобы огромные значения не переполняли int и не раздували память
+	nFreqsEstimate := float64(pd.config.SamplesPerPeak) * T * (maxFreq - minFreq)
+	nFreqs := minFrequencies
+	if nFreqsEstimate > maxFrequencies {
+		nFreqs = maxFrequencies
+	} else if nFreqsEstimate > minFrequencies {
+		nFreqs = int(nFreqsEstimate)
+	}
+	return nFreqs
+}
+
+// adaptiveBands возвращает количество частот в каждой логарифмической полосе,
+// их сумму и отношение границ полосы. Сумма не превышает maxFrequencies: если
+// полосам нужно больше, каждая получает minFrequencies (или поровну, если и это
+// не умещается), а остаток делится пропорционально их собственным потребностям.
+func (pd *periodDetector) adaptiveBands(T, minFreq, maxFreq float64) (counts []int, total int, ratio float64) {
+	nBands := int(math.Ceil(math.Log10(maxFreq / minFreq)))
+	if nBands < 1 {
+		nBands = 1
+	}
+	ratio = math.Pow(maxFreq/minFreq, 1/float64(nBands))
+
+	counts = make([]int, nBands)
+	for k := range counts {
+		lo := minFreq * math.Pow(ratio, float64(k))
+		counts[k] = pd.frequencyCount(T, lo, lo*ratio)
+		total += counts[k]
+	}
+
+	if total > maxFrequencies {
+		floor := minFrequencies
+		if floor*nBands > maxFrequencies {
+			floor = maxFrequencies / nBands
+		}
+		extra, budget := total-floor*nBands, maxFrequencies-floor*nBands
+		total = 0
+		for k := range counts {
+			counts[k] = floor + int(float64(counts[k]-floor)*float64(budget)/float64(extra))
+			total += counts[k]
+		}
+	}
+	return counts, total, ratio
+}
+
+// gridSize возвращает количество частот сетки, которую построит frequencyGrid
+func (pd *periodDetector) gridSize(T, minFreq, maxFreq float64) int {
+	if pd.config.Adaptive {
+		_, total, _ := pd.adaptiveBands(T, minFreq, maxFreq)
+		return total
+	}
+	return pd.frequencyCount(T, minFreq, maxFreq)
+}
+
+// estimateOperations оценивает количество вычислений sin/cos для n событий на
+// длительности T часов: размер сетки частот, умноженный на n и на число полных
+// проходов по данным (allTime, кварталы, месяцы, дни недели, непрерывные области),
+// каждый - в диапазоне периодов своей области с учетом ScopePeriodRanges.
+// Скользящие окна учитываются отдельно: каждое событие попадает в
+// RollingWindow / RollingStep окон со своей сеткой частот. Окна daily и weekly
+// содержат малую долю событий и не учитываются.
+func (pd *periodDetector) estimateOperations(n int, T float64) int64 {
+	scopes := []string{ScopeAllTime, ScopeQuarterly}
+	if pd.config.ByWeekday {
+		scopes = append(scopes, ScopeWeekday)
+	}
+	if pd.config.ByMonth {
+		scopes = append(scopes, ScopeMonthly)
+	}
+	if !pd.config.SkipContinuous {
+		scopes = append(scopes, ScopeAllTime, ScopeAllTime)
+	}
+	var ops int64
+	for _, scope := range scopes {
+		minPeriod, maxPeriod := pd.configuredPeriodRange(scope, "")
+		ops += int64(pd.gridSize(T, 1/maxPeriod, 1/minPeriod)) * int64(n)
+	}
+
+	if window, step := pd.config.RollingWindow, pd.config.RollingStep; window > 0 && step > 0 {
+		minPeriod, maxPeriod := pd.configuredPeriodRange(ScopeRolling, "")
+		windowFreqs := pd.gridSize(math.Min(window.Hours(), T), 1/maxPeriod, 1/minPeriod)
+		perEvent := int64(math.Ceil(float64(window) / float64(step)))
+		ops += int64(windowFreqs) * int64(n) * perEvent
+	}
+	return ops
+}
+
+// adaptiveFrequencies строит сетку частот из логарифмических полос (по декаде периодов).
+// Каждая полоса получает собственное разрешение, поэтому длинные периоды разрешаются
+// так же хорошо, как короткие, без единой линейной сетки; общий размер сетки, как и
+// у линейной, не превышает maxFrequencies (см. adaptiveBands). Полосы склеиваются
+// в одну возрастающую сетку, и поиск пиков работает по ней как по обычной.
+func (pd *periodDetector) adaptiveFrequencies(T, minFreq, maxFreq float64, buf *spectrumBuffers) ([]float64, []float64) {
+	counts, total, ratio := pd.adaptiveBands(T, minFreq, maxFreq)
+	nBands := len(counts)
+
+	freqs, powers := buf.resize(total)
+	i := 0
+	for k, n := range counts {
+		lo := minFreq * math.Pow(ratio, float64(k))
+		hi := lo * ratio
+
+		// Полосы полуоткрыты [lo, hi), последняя включает maxFreq
+		step := (hi - lo) / float64(n)
+		if k == nBands-1 {
+			hi = maxFreq
+			step = (hi - lo) / float64(n-1)
+		}
+		for j := 0; j < n; j++ {
+			freqs[i] = lo + float64(j)*step
+			i++
+		}
+	}
+
+	return freqs, powers
+}
+
+// computePower вычисляет мощность для заданной частоты. Нормировка на сумму квадратов
+// весов WSq (для невзвешенных событий - N) сохраняет единичное среднее мощности
+// при отсутствии периодичности.
+func (pd *periodDetector) computePower(times, weights []float64, freq, WSq float64) float64 {
+	sumCos, sumSin := phaseSums(times, weights, 2*math.Pi*freq)
+	return (sumCos*sumCos + sumSin*sumSin) / WSq
+}
+
+// rawComponents возвращает суммы периодограммы на частоте freq; параметры - как в
+// computePeriodogram. Для измерений w = 1/σ², а суммы cos и sin взвешены по w·y.
+func rawComponents(times, weights, precisions []float64, wsq, freq float64) *RawComponents {
+	raw := &RawComponents{N: len(times), SumWeights: float64(len(times)), SumSquaredWeights: float64(len(times))}
+	if precisions != nil {
+		raw.SumWeights, raw.SumSquaredWeights = 0, 0
+		products := make([]float64, len(times))
+		for i, w := range precisions {
+			products[i] = w * weights[i]
+			raw.SumWeights += w
+			raw.SumSquaredWeights += w * w
+		}
+		raw.SumCos, raw.SumSin = phaseSums(times, products, 2*math.Pi*freq)
+		return raw
+	}
+	raw.SumCos, raw.SumSin = phaseSums(times, weights, 2*math.Pi*freq)
+	if weights != nil {
+		raw.SumWeights, raw.SumSquaredWeights = 0, 0
+		for _, w := range weights {
+			raw.SumWeights += w
+			raw.SumSquaredWeights += w * w
+		}
+		if wsq > 0 {
+			raw.SumSquaredWeights = wsq
+		}
+	}
+	return raw
+}
+
+// measurementPowerFunc возвращает мощность взвешенной обобщенной периодограммы
+// Ломба-Скаргла (Zechmeister & Kürster, 2009, ур. 4-15) для измерений values в
+// моменты times с весами precisions (1/σ²). С нормированными весами w (Σw = 1)
+// и взвешенным средним ȳ = Σw·y:
+//
+//	YY = Σw(y-ȳ)², YC = Σw(y-ȳ)cos(ωt), YS = Σw(y-ȳ)sin(ωt),
+//	CC, SS, CS - взвешенные ковариации cos(ωt) и sin(ωt),
+//	p = (SS·YC² + CC·YS² - 2·CS·YC·YS) / (YY·(CC·SS - CS²)).
+//
+// p - доля дисперсии, объясненная синусоидой, от 0 до 1; для единой шкалы с
+// периодограммой событий она умножается на (N-1)/2, и тогда при отсутствии
+// периодичности мощность распределена приблизительно экспоненциально с единичным
+// средним (см. powerPValue). Постоянные измерения дают нулевую мощность на всех
+// частотах. Возвращает nil, если сумма весов не положительна.
+func measurementPowerFunc(times, values, precisions []float64) func(freq float64) float64 {
+	W := 0.0
+	for _, w := range precisions {
+		W += w
+	}
+	if W <= 0 {
+		return nil
+	}
+	weights := make([]float64, len(precisions))
+	mean, squares := 0.0, 0.0
+	for i, w := range precisions {
+		weights[i] = w / W
+		mean += weights[i] * values[i]
+		squares += weights[i] * values[i] * values[i]
+	}
+	residuals := make([]float64, len(values))
+	YY := 0.0
+	for i, y := range values {
+		residuals[i] = y - mean
+		YY += weights[i] * residuals[i] * residuals[i]
+	}
+	if YY <= 1e-12*squares {
+		// Постоянный ряд (с точностью до округления): периодичности нет
+		return func(float64) float64 { return 0 }
+	}
+	scale := float64(len(times)-1) / 2
+
+	return func(freq float64) float64 {
+		omega := 2 * math.Pi * freq
+		var C, S, YC, YS, CCw, CSw float64
+		for i, t := range times {
+			sin, cos := math.Sincos(omega * t)
+			w := weights[i]
+			C += w * cos
+			S += w * sin
+			YC += w * residuals[i] * cos
+			YS += w * residuals[i] * sin
+			CCw += w * cos * cos
+			CSw += w * cos * sin
+		}
+		CC := CCw - C*C
+		SS := (1 - CCw) - S*S
+		CS := CSw - C*S
+		D := CC*SS - CS*CS
+		if D <= 1e-12 {
+			return 0
+		}
+		return scale * (SS*YC*YC + CC*YS*YS - 2*CS*YC*YS) / (YY * D)
+	}
+}
+
+// phaseSums возвращает Σw·cos(ωt) и Σw·sin(ωt); при weights == nil все веса равны 1
+func phaseSums(times, weights []float64, omega float64) (sumCos, sumSin float64) {
+	if weights == nil {
+		for _, t := range times {
+			sumCos += math.Cos(omega * t)
+			sumSin += math.Sin(omega * t)
+		}
+		return sumCos, sumSin
+	}
+
+	for i, t := range times {
+		sumCos += weights[i] * math.Cos(omega*t)
+		sumSin += weights[i] * math.Sin(omega*t)
+	}
+	return sumCos, sumSin
+}
+
+// computeFloatingMeanPower вычисляет обобщенную периодограмму Ломба-Скаргла с плавающим
+// средним (Zechmeister & Kürster, 2009, A&A 496, 577). Модель y = a·cos(ωt) + b·sin(ωt) + c
+// с константой c подгоняется для каждой частоты решением нормальных уравнений 2x2
+// после исключения c, поэтому среднюю интенсивность не нужно знать заранее.
+//
+// Поток событий рассматривается как предел счетчиков в бесконечно узких интервалах
+// на окне наблюдения [t0, t1]: суммы y·cos и y·sin превращаются в суммы по событиям,
+// а суммы cos, sin, cos², sin², sin·cos по сетке - в интегралы по окну, которые
+// вычисляются аналитически.
+//
+// Для взвешенных событий (AnalyzeSamples) вместо количества событий используется
+// сумма весов W, а нормировка выполняется по сумме квадратов весов WSq.
+func (pd *periodDetector) computeFloatingMeanPower(times, weights []float64, freq, t0, t1, W, WSq float64) float64 {
+	omega := 2 * math.Pi * freq
+	sumCos, sumSin := phaseSums(times, weights, omega)
+	return floatingMeanPower(sumCos, sumSin, W, WSq, omega, t0, t1)
+}
+
+// floatingMeanPower вычисляет мощность модели с плавающим средним по суммам
+// w·cos(ωt) и w·sin(ωt) событий с суммой весов W и суммой квадратов весов WSq
+// на окне наблюдения [t0, t1]. Для невзвешенных событий W = WSq = N.
+func floatingMeanPower(sumCos, sumSin, W, WSq, omega, t0, t1 float64) float64 {
+	wT := omega * (t1 - t0)
+
+	// Средние значения базисных функций по окну наблюдения
+	C := (math.Sin(omega*t1) - math.Sin(omega*t0)) / wT
+	S := (math.Cos(omega*t0) - math.Cos(omega*t1)) / wT
+	CCw := 0.5 + (math.Sin(2*omega*t1)-math.Sin(2*omega*t0))/(4*wT)
+	SSw := 1 - CCw
+	CSw := (math.Cos(2*omega*t0) - math.Cos(2*omega*t1)) / (4 * wT)
+
+	// Центрированные моменты (обозначения Zechmeister & Kürster, ур. 10-15)
+	CC := CCw - C*C
+	SS := SSw - S*S
+	CS := CSw - C*S
+	D := CC*SS - CS*CS
+	if D <= 1e-12 {
+		return 0
+	}
+
+	// Отклонения от равномерной интенсивности (YC и YS с точностью до масштаба)
+	YC := sumCos - W*C
+	YS := sumSin - W*S
+
+	// Нормировка согласована с computePower: при CC = SS = 1/2 и C = S = CS = 0
+	// результат совпадает с (Σw·cos² + Σw·sin²) / WSq
+	return (SS*YC*YC + CC*YS*YS - 2*CS*YC*YS) / (2 * WSq * D)
+}
+
+// findSignificantPeaks возвращает пики периодограммы по убыванию мощности, отобранные
+// selectPeriods; при numPeriods <= 0 возвращаются все пики
+func (pd *periodDetector) findSignificantPeaks(freqs, powers []float64, numPeriods int) []PeriodResult {
+	// Вычисляем общую мощность и ее разброс для нормализации до применения маски
+	stats := newSpectrumStats(powers)
+
+	// Обнуляем частоты исключенных периодов
+	pd.maskExcludedPeriods(freqs, powers)
+
+	// Находим все локальные максимумы
+	peaks := findLocalPeaks(powers, pd.config.MinProminence*findMaxPower(powers), pd.config.PeakNeighborhood, pd.config.EdgeExclusionBins)
+	if len(peaks) == 0 {
+		return nil
+	}
+
+	// Сортируем пики по мощности (по убыванию)
+	sortPeaksByPower(peaks, powers)
+
+	// Ограничиваем количество возвращаемых периодов; при CumulativeSignificance
+	// отбор возможен только после расчета значимости
+	if numPeriods > 0 && pd.config.CumulativeSignificance == 0 && len(peaks) > numPeriods {
+		peaks = peaks[:numPeriods]
+	}
+
+	// Формируем результаты
+	results := make([]PeriodResult, len(peaks))
+	for i, idx := range peaks {
+		results[i] = pd.newPeriodResult(freqs[idx], powers[idx], stats)
+		results[i].PeakWidth = peakWidth(freqs, powers, idx)
+		results[i].bin = idx
+	}
+
+	if numPeriods > 0 {
+		return pd.selectPeriods(results, numPeriods)
+	}
+	return results
+}
+
+// spectrumStats - характеристики периодограммы области для нормировки результатов
+type spectrumStats struct {
+	total float64 // Сумма мощностей (не меньше 1e-10)
+	mean  float64
+	std   float64
 }
 
-func newPeriodDetector(config PeriodConfig) *periodDetector {
-	return &periodDetector{config: config}
+func newSpectrumStats(powers []float64) spectrumStats {
+	total, sumSquares := 0.0, 0.0
+	for _, p := range powers {
+		total += p
+		sumSquares += p * p
+	}
+	mean := total / float64(len(powers))
+	std := math.Sqrt(math.Max(sumSquares/float64(len(powers))-mean*mean, 0))
+	if total < 1e-10 {
+		total = 1e-10
+	}
+	return spectrumStats{total: total, mean: mean, std: std}
 }
 
-// detect выполняет обнаружение периодов для набора временных меток
-func (pd *periodDetector) detect(times []time.Time) []PeriodResult {
-	if len(times) < 4 {
-		return nil
+// newPeriodResult формирует результат для частоты freq с мощностью power
+func (pd *periodDetector) newPeriodResult(freq, power float64, stats spectrumStats) PeriodResult {
+	period := 1 / freq
+	result := PeriodResult{
+		Period:       period,
+		PeriodLabel:  humanizeHours(period),
+		Power:        power,
+		Significance: power / stats.total * 100,
+
+		PValue: powerPValue(power),
 	}
+	if stats.std > 0 {
+		result.ZScore = (power - stats.mean) / stats.std
+	}
+	if pd.config.ReferencePeriod > 0 {
+		result.PeriodRatio = period / pd.config.ReferencePeriod
+	}
+	return result
+}
 
-	// Конвертация в часы относительно минимального времени
-	timesHours := convertToHours(times)
+// refinePeaks уточняет частоту и мощность каждого периода, вычисляя мощность на
+// refineSteps частотах между соседями его отсчета сетки и затем еще на refineSteps
+// частотах вокруг лучшей из них. Истинный максимум часто лежит между отсчетами,
+// и уточнение дешевле общего увеличения SamplesPerPeak. Периоды переупорядочиваются
+// по уточненной мощности.
+func (pd *periodDetector) refinePeaks(periods []PeriodResult, freqs []float64, power func(freq float64) float64, stats spectrumStats) {
+	for i, p := range periods {
+		if p.bin <= 0 || p.bin >= len(freqs)-1 {
+			continue
+		}
+		bestFreq, bestPower := freqs[p.bin], p.Power
+		lo, hi := freqs[p.bin-1], freqs[p.bin+1]
+		for pass := 0; pass < 2; pass++ {
+			step := (hi - lo) / (refineSteps + 1)
+			for k := 1; k <= refineSteps; k++ {
+				f := lo + float64(k)*step
+				if pw := power(f); pw > bestPower {
+					bestFreq, bestPower = f, pw
+				}
+			}
+			lo, hi = bestFreq-step, bestFreq+step
+		}
 
-	// Вычисление периодограммы
-	freqs, powers := pd.computePeriodogram(timesHours)
+		refined := pd.newPeriodResult(bestFreq, bestPower, stats)
+		refined.PeakWidth = p.PeakWidth
+		refined.bin = p.bin
+		periods[i] = refined
+	}
 
-	// Поиск значимых пиков
-	return pd.findSignificantPeaks(freqs, powers)
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].Power > periods[j].Power
+	})
 }
 
-// computePeriodogram вычисляет периодограмму Ломба-Скаргла
-func (pd *periodDetector) computePeriodogram(times []float64) ([]float64, []float64) {
-	minFreq := 1 / pd.config.MaxPeriod
-	maxFreq := 1 / pd.config.MinPeriod
+// refineSteps - количество дополнительных частот на каждом проходе RefinePeaks
+const refineSteps = 8
 
-	// Рассчитываем количество частот
-	T := times[len(times)-1] - times[0]
-	if T <= 0 {
-		return nil, nil
+// fundamentalHarmonics - количество членов гармонической гребенки Fundamental,
+// fundamentalCandidates - количество самых мощных пиков allTime, среди которых
+// выбирается основной период
+const (
+	fundamentalHarmonics  = 4
+	fundamentalCandidates = 20
+)
+
+// findFundamental возвращает период с наибольшей оценкой гармонической гребенки
+// (см. AnalysisResult.Fundamental) по мощности power. Погрешность частоты каждого
+// кандидата - половина шага сетки freqs вокруг его отсчета. Возвращает индекс
+// периода в periods или -1 для пустого списка.
+func findFundamental(periods []PeriodResult, freqs []float64, power func(freq float64) float64) int {
+	best := -1
+	bestScore := math.Inf(-1)
+	for i, p := range periods {
+		// Сетка может быть неравномерной (Adaptive), поэтому шаг берется у соседей отсчета
+		lo, hi := p.bin-1, p.bin+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(freqs)-1 {
+			hi = len(freqs) - 1
+		}
+		halfStep := 0.0
+		if hi > lo {
+			halfStep = (freqs[hi] - freqs[lo]) / float64(2*(hi-lo))
+		}
+		freq := 1 / p.Period
+		score := 0.0
+		for k := 1; k <= fundamentalHarmonics; k++ {
+			harmonic := 0.0
+			for j := -2; j <= 2; j++ {
+				harmonic = math.Max(harmonic, power(float64(k)*(freq+float64(j)*halfStep/2)))
+			}
+			score += harmonic / float64(k)
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
 	}
+	return best
+}
 
-	nFreqs := int(float64(pd.config.SamplesPerPeak) * T * (maxFreq - minFreq))
-	if nFreqs < 100 {
-		nFreqs = 100
-	} else if nFreqs > 10000 {
-		nFreqs = 10000
+// selectPeriods отбирает периоды из упорядоченных по убыванию мощности: первые
+// numPeriods или, при CumulativeSignificance, наименьшее число первых периодов,
+// суммарная значимость которых достигает порога
+func (pd *periodDetector) selectPeriods(periods []PeriodResult, numPeriods int) []PeriodResult {
+	if threshold := pd.config.CumulativeSignificance; threshold > 0 {
+		cumulative := 0.0
+		for i, p := range periods {
+			if cumulative += p.Significance; cumulative >= threshold*100 {
+				return periods[:i+1]
+			}
+		}
+		return periods
 	}
 
-	freqs := make([]float64, nFreqs)
-	powers := make([]float64, nFreqs)
+	if len(periods) > numPeriods {
+		return periods[:numPeriods]
+	}
+	return periods
+}
 
-	// Шаг по частоте
-	df := (maxFreq - minFreq) / float64(nFreqs-1)
+// peakWidth возвращает ширину пика idx на половине высоты в часах периода.
+// Границы находятся линейной интерполяцией между соседними отсчетами; если мощность
+// не опускается до половины до края сетки, границей служит крайняя частота.
+func peakWidth(freqs, powers []float64, idx int) float64 {
+	half := powers[idx] / 2
+
+	left := freqs[0]
+	for i := idx; i > 0; i-- {
+		if powers[i-1] <= half {
+			left = interpolateCrossing(freqs[i-1], freqs[i], powers[i-1], powers[i], half)
+			break
+		}
+	}
 
-	// Вычисляем мощность для каждой частоты
-	for i := 0; i < nFreqs; i++ {
-		f := minFreq + float64(i)*df
-		freqs[i] = f
-		powers[i] = pd.computePower(times, f)
+	right := freqs[len(freqs)-1]
+	for i := idx; i < len(freqs)-1; i++ {
+		if powers[i+1] <= half {
+			right = interpolateCrossing(freqs[i+1], freqs[i], powers[i+1], powers[i], half)
+			break
+		}
 	}
 
-	return freqs, powers
+	if left <= 0 || right <= left {
+		return 0
+	}
+	return 1/left - 1/right
 }
 
-// computePower вычисляет мощность для заданной частоты
-func (pd *periodDetector) computePower(times []float64, freq float64) float64 {
-	omega := 2 * math.Pi * freq
-	N := float64(len(times))
-
-	var sumCos, sumSin float64
-	for _, t := range times {
-		sumCos += math.Cos(omega * t)
-		sumSin += math.Sin(omega * t)
+// interpolateCrossing возвращает частоту между f0 и f1, на которой линейная
+// интерполяция мощности от p0 до p1 достигает level (p0 <= level < p1)
+func interpolateCrossing(f0, f1, p0, p1, level float64) float64 {
+	if p1 == p0 {
+		return f0
 	}
+	return f0 + (f1-f0)*(level-p0)/(p1-p0)
+}
 
-	return (sumCos*sumCos + sumSin*sumSin) / N
+// powerPValue возвращает p-значение мощности отдельной частоты.
+//
+// Нулевая гипотеза - события образуют однородный пуассоновский поток, то есть
+// фазы ωt независимы и равномерно распределены. Тогда Σcos и Σsin асимптотически
+// независимы и нормальны с дисперсией N/2, а нормированная мощность
+// (Σcos² + Σsin²) / N распределена экспоненциально с единичным средним:
+// P(Z > z) = exp(-z). Для модели с плавающим средним то же распределение
+// получается в пределе большого N, поскольку поправка на среднее имеет порядок 1/N.
+//
+// Оценка верна для одной заранее выбранной частоты и при достаточно большом
+// числе событий; вероятность ложной тревоги для максимума по всей сетке частот
+// существенно выше. Кластеризация событий (всплески, дубликаты) нарушает
+// предположение о независимости и занижает p-значение.
+func powerPValue(power float64) float64 {
+	return math.Exp(-power)
 }
 
-func (pd *periodDetector) findSignificantPeaks(freqs, powers []float64) []PeriodResult {
-	// Находим все локальные максимумы
-	peaks := findLocalPeaks(powers)
-	if len(peaks) == 0 {
-		return nil
+// maskExcludedPeriods обнуляет мощность частот, период которых совпадает
+// с одним из ExcludePeriods с допуском PeriodTolerance
+func (pd *periodDetector) maskExcludedPeriods(freqs, powers []float64) {
+	if len(pd.config.ExcludePeriods) == 0 {
+		return
 	}
+	tolerance := effectiveTolerance(pd.config.PeriodTolerance)
+	for i, f := range freqs {
+		for _, excluded := range pd.config.ExcludePeriods {
+			if periodsMatch(1/f, excluded, tolerance) {
+				powers[i] = 0
+				break
+			}
+		}
+	}
+}
 
-	// Сортируем пики по мощности (по убыванию)
-	sortPeaksByPower(peaks, powers)
-
-	// Ограничиваем количество возвращаемых периодов
-	if len(peaks) > pd.config.NumPeriods {
-		peaks = peaks[:pd.config.NumPeriods]
+// humanizeHours форматирует длительность в часах в естественных единицах:
+// "7d", "2d12h", "24h", "1h30m", "6m". Точность зависит от величины:
+// от двух суток - до часа, от часа - до минуты, иначе - до секунды.
+func humanizeHours(hours float64) string {
+	d := time.Duration(hours * float64(time.Hour))
+	switch {
+	case d >= 48*time.Hour:
+		d = d.Round(time.Hour)
+	case d >= time.Hour:
+		d = d.Round(time.Minute)
+	default:
+		d = d.Round(time.Second)
 	}
 
-	// Вычисляем общую мощность для нормализации
-	totalPower := 0.0
-	for _, p := range powers {
-		totalPower += p
+	var label string
+	if d >= 48*time.Hour {
+		label = fmt.Sprintf("%dd", d/(24*time.Hour))
+		d %= 24 * time.Hour
 	}
-	if totalPower < 1e-10 {
-		totalPower = 1e-10
+	if h := d / time.Hour; h > 0 {
+		label += fmt.Sprintf("%dh", h)
 	}
-
-	// Формируем результаты
-	results := make([]PeriodResult, len(peaks))
-	for i, idx := range peaks {
-		period := 1 / freqs[idx]
-		power := powers[idx]
-		significance := power / totalPower * 100
-
-		results[i] = PeriodResult{
-			Period:       period,
-			Power:        power,
-			Significance: significance,
-		}
+	if m := d % time.Hour / time.Minute; m > 0 {
+		label += fmt.Sprintf("%dm", m)
+	}
+	if s := d % time.Minute / time.Second; s > 0 {
+		label += fmt.Sprintf("%ds", s)
+	}
+	if label == "" {
+		label = "0s"
 	}
 
-	return results
+	return label
 }
 
-// findLocalPeaks находит локальные максимумы
-func findLocalPeaks(data []float64) []int {
+// findLocalPeaks находит локальные максимумы, превышающие все отсчеты в пределах
+// ±halfWidth (не менее 1) не менее чем на minProminence. Первые и последние edgeBins
+// (не менее 1) отсчетов пиками не считаются.
+func findLocalPeaks(data []float64, minProminence float64, halfWidth, edgeBins int) []int {
+	if halfWidth < 1 {
+		halfWidth = 1
+	}
+	if edgeBins < 1 {
+		edgeBins = 1
+	}
+
 	var peaks []int
-	for i := 1; i < len(data)-1; i++ {
-		if data[i] > data[i-1] && data[i] > data[i+1] {
+	for i := edgeBins; i < len(data)-edgeBins; i++ {
+		neighbor := math.Inf(-1)
+		for j := i - halfWidth; j <= i+halfWidth; j++ {
+			if j >= 0 && j < len(data) && j != i {
+				neighbor = math.Max(neighbor, data[j])
+			}
+		}
+		prominence := data[i] - neighbor
+		if prominence > 0 && prominence >= minProminence {
 			peaks = append(peaks, i)
 		}
 	}
 	return peaks
 }
 
-// sortPeaksByPower сортирует пики по мощности (по убыванию)
+// sortPeaksByPower сортирует пики по мощности (по убыванию). Пики с равной мощностью,
+// частые на квантованных данных, упорядочиваются по возрастанию индекса частоты,
+// чтобы одинаковые входные данные всегда давали одинаковый порядок.
 func sortPeaksByPower(peaks []int, powers []float64) {
-	sort.Slice(peaks, func(i, j int) bool {
-		return powers[peaks[i]] > powers[peaks[j]]
+	sort.SliceStable(peaks, func(i, j int) bool {
+		if powers[peaks[i]] != powers[peaks[j]] {
+			return powers[peaks[i]] > powers[peaks[j]]
+		}
+		return peaks[i] < peaks[j]
 	})
 }
 
@@ -286,6 +2571,119 @@ func findMaxPower(powers []float64) float64 {
 	return max
 }
 
+// sampleTimestamps отбирает каждое событие независимо с вероятностью fraction,
+// сохраняя порядок; values и precisions (если не nil) отбираются вместе с метками
+func sampleTimestamps(timestamps []int64, values, precisions []float64, fraction float64, seed int64) ([]int64, []float64, []float64) {
+	rng := rand.New(rand.NewSource(seed))
+	sampledTimestamps := make([]int64, 0, int(float64(len(timestamps))*fraction)+1)
+	var sampledValues, sampledPrecisions []float64
+	for i, ts := range timestamps {
+		if rng.Float64() >= fraction {
+			continue
+		}
+		sampledTimestamps = append(sampledTimestamps, ts)
+		if values != nil {
+			sampledValues = append(sampledValues, values[i])
+		}
+		if precisions != nil {
+			sampledPrecisions = append(sampledPrecisions, precisions[i])
+		}
+	}
+	return sampledTimestamps, sampledValues, sampledPrecisions
+}
+
+// jitterDuplicates сдвигает повторы совпадающих временных меток на случайную величину
+// в пределах ±jitter/2. Первое вхождение каждого значения не изменяется. Метки
+// обрабатываются в порядке времени, поэтому результат определяется только seed.
+// Возвращает количество сдвинутых меток.
+func jitterDuplicates(times []time.Time, jitter time.Duration, seed int64) int {
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return times[order[i]].Before(times[order[j]])
+	})
+
+	rng := rand.New(rand.NewSource(seed))
+	jittered := 0
+	var previous time.Time
+
+	for k, idx := range order {
+		original := times[idx]
+		if k > 0 && original.Equal(previous) {
+			offset := time.Duration((rng.Float64() - 0.5) * float64(jitter))
+			times[idx] = original.Add(offset)
+			jittered++
+		}
+		previous = original
+	}
+
+	return jittered
+}
+
+// runTasks выполняет независимые задачи не более чем в parallelism горутинах.
+// При parallelism <= 1 задачи выполняются последовательно в исходном порядке.
+func runTasks(tasks []func(), parallelism int) {
+	if parallelism <= 1 {
+		for _, task := range tasks {
+			task()
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallelism)
+	for _, task := range tasks {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(task func()) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			task()
+		}(task)
+	}
+	wg.Wait()
+}
+
+// sampleWeights сопоставляет моментам времени веса событий. Совпадающие метки
+// получают среднее значение, чтобы их суммарный вклад был равен сумме значений.
+func sampleWeights(times []time.Time, values []float64) map[int64]float64 {
+	weights := make(map[int64]float64, len(times))
+	counts := make(map[int64]int, len(times))
+	for i, t := range times {
+		key := t.UnixNano()
+		weights[key] += values[i]
+		counts[key]++
+	}
+	for key, n := range counts {
+		if n > 1 {
+			weights[key] /= float64(n)
+		}
+	}
+	return weights
+}
+
+// measurementWeights сопоставляет моментам времени измерения и их веса 1/σ².
+// Совпадающие метки объединяются во взвешенное среднее измерений, а вес делится
+// между ними поровну, чтобы их суммарный вес был равен сумме весов.
+func measurementWeights(times []time.Time, values, precisions []float64) (means, weights map[int64]float64) {
+	means = make(map[int64]float64, len(times))
+	weights = make(map[int64]float64, len(times))
+	counts := make(map[int64]int, len(times))
+	for i, t := range times {
+		key := t.UnixNano()
+		means[key] += precisions[i] * values[i]
+		weights[key] += precisions[i]
+		counts[key]++
+	}
+	for key, n := range counts {
+		means[key] /= weights[key]
+		weights[key] /= float64(n)
+	}
+	return means, weights
+}
+
 // findDateRange определяет временной диапазон
 func findDateRange(times []time.Time) (start, end time.Time) {
 	if len(times) == 0 {
@@ -307,37 +2705,123 @@ func findDateRange(times []time.Time) (start, end time.Time) {
 	return start, end
 }
 
-// convertToHours конвертирует временные метки в часы относительно минимального времени
-func convertToHours(times []time.Time) []float64 {
+// interArrivalStats возвращает среднее и медианное время между соседними
+// событиями и регулярность шага (см. SamplingRegularity). Метки должны быть
+// упорядочены по времени.
+func interArrivalStats(sorted []time.Time) (mean, median time.Duration, regularity float64) {
+	if len(sorted) < 2 {
+		return 0, 0, 0
+	}
+
+	gaps := make([]time.Duration, len(sorted)-1)
+	for i := range gaps {
+		gaps[i] = sorted[i+1].Sub(sorted[i])
+	}
+	mean = sorted[len(sorted)-1].Sub(sorted[0]) / time.Duration(len(gaps))
+
+	// Коэффициент вариации интервалов
+	if mean > 0 {
+		var variance float64
+		for _, gap := range gaps {
+			d := float64(gap - mean)
+			variance += d * d
+		}
+		cv := math.Sqrt(variance/float64(len(gaps))) / float64(mean)
+		regularity = math.Max(0, math.Min(1, 1-cv))
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i] < gaps[j]
+	})
+	mid := len(gaps) / 2
+	median = gaps[mid]
+	if len(gaps)%2 == 0 {
+		median = (gaps[mid-1] + gaps[mid]) / 2
+	}
+
+	return mean, median, regularity
+}
+
+// hourProfile возвращает количество событий по часу суток в зоне каждой метки
+func hourProfile(times []time.Time) []int {
+	profile := make([]int, 24)
+	for _, t := range times {
+		profile[t.Hour()]++
+	}
+	return profile
+}
+
+// activityMatrix возвращает количество событий по дню недели и часу суток в зоне
+// каждой метки
+func activityMatrix(times []time.Time) [7][24]int {
+	var matrix [7][24]int
+	for _, t := range times {
+		matrix[t.Weekday()][t.Hour()]++
+	}
+	return matrix
+}
+
+// shannonEntropy возвращает энтропию Шеннона распределения counts в битах
+func shannonEntropy(counts []int) float64 {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(total)
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// convertToHours конвертирует временные метки в часы относительно anchor,
+// а при нулевом anchor - относительно минимального времени
+func convertToHours(times []time.Time, anchor time.Time) []float64 {
 	if len(times) == 0 {
 		return nil
 	}
 
 	// Находим минимальное время
-	minTime := times[0]
-	for _, t := range times {
-		if t.Before(minTime) {
-			minTime = t
+	if anchor.IsZero() {
+		anchor = times[0]
+		for _, t := range times {
+			if t.Before(anchor) {
+				anchor = t
+			}
 		}
 	}
 
 	// Конвертируем в часы
 	result := make([]float64, len(times))
 	for i, t := range times {
-		duration := t.Sub(minTime)
+		duration := t.Sub(anchor)
 		result[i] = duration.Hours()
 	}
 
 	return result
 }
 
-// filterByTimeRange фильтрует временные метки по диапазону
+// toUnixMillis конвертирует время в временные метки в миллисекундах
+func toUnixMillis(times []time.Time) []int64 {
+	result := make([]int64, len(times))
+	for i, t := range times {
+		result[i] = t.UnixMilli()
+	}
+	return result
+}
+
+// filterByTimeRange фильтрует временные метки по диапазону [end - duration, end + 24h].
+// Обе границы включаются, чтобы события, выровненные по часам, не терялись на краях окна.
 func filterByTimeRange(times []time.Time, end time.Time, duration time.Duration) []time.Time {
 	startTime := end.Add(-duration)
+	endTime := end.Add(24 * time.Hour)
 	var result []time.Time
 
 	for _, t := range times {
-		if t.After(startTime) && t.Before(end.Add(24*time.Hour)) {
+		if !t.Before(startTime) && !t.After(endTime) {
 			result = append(result, t)
 		}
 	}
@@ -345,24 +2829,119 @@ func filterByTimeRange(times []time.Time, end time.Time, duration time.Duration)
 	return result
 }
 
-// detectQuarterlyPeriods выполняет анализ по кварталам
-func detectQuarterlyPeriods(times []time.Time, detector *periodDetector) map[string][]PeriodResult {
-	quarters := groupByQuarter(times)
+// detectQuarterlyPeriods выполняет анализ по кварталам. Кварталы с количеством
+// событий меньше MinQuarterRecords не анализируются и возвращаются в skipped
+func detectQuarterlyPeriods(times []time.Time, detector *periodDetector) (results map[string][]PeriodResult, skipped map[string]int) {
+	quarters := groupByQuarter(times, detector.config.location())
+	results = make(map[string][]PeriodResult)
+
+	// Обходим кварталы по порядку, чтобы порядок ResultSink и предупреждений не зависел от map
+	for _, quarter := range sortedKeys(quarters) {
+		if n := len(quarters[quarter]); n < detector.config.MinQuarterRecords {
+			if skipped == nil {
+				skipped = make(map[string]int)
+			}
+			skipped[quarter] = n
+			continue
+		}
+		results[quarter] = detector.detectScope(ScopeQuarterly, quarter, quarters[quarter])
+	}
+
+	return results, skipped
+}
+
+// detectRollingPeriods выполняет обнаружение периодов в скользящих окнах
+// [start, start + RollingWindow), сдвигаемых на RollingStep от первой метки,
+// пока окно не охватит последнюю метку. Метки должны быть упорядочены по времени.
+func detectRollingPeriods(sorted []time.Time, detector *periodDetector) []RollingResult {
+	last := sorted[len(sorted)-1]
+
+	var results []RollingResult
+	for start := sorted[0]; ; start = start.Add(detector.config.RollingStep) {
+		end := start.Add(detector.config.RollingWindow)
+		from := sort.Search(len(sorted), func(i int) bool { return !sorted[i].Before(start) })
+		to := sort.Search(len(sorted), func(i int) bool { return !sorted[i].Before(end) })
+		window := sorted[from:to]
+
+		results = append(results, RollingResult{
+			Start:       start,
+			End:         end,
+			RecordCount: len(window),
+			Periods:     nonNil(detector.detectScope(ScopeRolling, start.Format(time.RFC3339), window)),
+		})
+		if end.After(last) {
+			break
+		}
+	}
+
+	return results
+}
+
+// maxRollingWindows - наибольшее количество скользящих окон; больше окон дает
+// слишком малый RollingStep, и анализ занял бы несоразмерное время
+const maxRollingWindows = 10000
+
+// rollingWindowCount возвращает количество окон detectRollingPeriods для данных
+// длительности span: окна добавляются, пока очередное не выйдет за последнюю метку
+func rollingWindowCount(span, window, step time.Duration) int64 {
+	if span < window {
+		return 1
+	}
+	return int64((span-window)/step) + 2
+}
+
+// detectMonthlyPeriods выполняет анализ по календарным месяцам
+func detectMonthlyPeriods(times []time.Time, detector *periodDetector) map[string][]PeriodResult {
+	months := groupByMonth(times, detector.config.location())
 	results := make(map[string][]PeriodResult)
 
-	for quarter, times := range quarters {
-		results[quarter] = detector.detect(times)
+	// Ключи "2023-06" упорядочены по времени, что задает порядок ResultSink и предупреждений
+	for _, month := range sortedKeys(months) {
+		key := month
+		if detector.config.MonthKeyFormat == MonthKeyNamed {
+			start, _ := time.Parse("2006-01", month)
+			key = start.Format("January 2006")
+		}
+		results[key] = detector.detectScope(ScopeMonthly, key, months[month])
 	}
 
 	return results
 }
 
-// groupByQuarter группирует временные метки по кварталам
-func groupByQuarter(times []time.Time) map[string][]time.Time {
+// groupByMonth группирует временные метки по календарным месяцам часового пояса loc
+// с ключами "2023-06"; границы месяцев - полночь первого числа по loc, как в groupByQuarter
+func groupByMonth(times []time.Time, loc *time.Location) map[string][]time.Time {
+	months := make(map[string][]time.Time)
+
+	for _, t := range times {
+		month := t.In(loc).Format("2006-01")
+		months[month] = append(months[month], t)
+	}
+
+	return months
+}
+
+// sortedKeys возвращает ключи групп в порядке возрастания
+func sortedKeys[V any](groups map[string]V) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// groupByQuarter группирует временные метки по кварталам часового пояса loc.
+// Квартал - полуоткрытый интервал [00:00:00 первого дня квартала, 00:00:00 первого
+// дня следующего квартала) по местному времени loc: метка ровно в полночь 1 апреля
+// по loc относится к Q2, а на наносекунду раньше - к Q1. Тот же момент в другом
+// часовом поясе может попасть в соседний квартал, поэтому границы определяются
+// только loc, а не зоной, в которой метка была создана.
+func groupByQuarter(times []time.Time, loc *time.Location) map[string][]time.Time {
 	quarters := make(map[string][]time.Time)
 
 	for _, t := range times {
-		quarter := getQuarter(t)
+		quarter := getQuarter(t.In(loc))
 		quarters[quarter] = append(quarters[quarter], t)
 	}
 
@@ -389,43 +2968,122 @@ func getQuarter(t time.Time) string {
 	return fmt.Sprintf("%d-Q%d", year, quarter)
 }
 
-// analyzeContinuousPeriods анализирует непрерывные периоды
-func analyzeContinuousPeriods(times []time.Time, detector *periodDetector) ContinuousResult {
-	result := ContinuousResult{}
-	if len(times) == 0 {
-		return result
+// minWeekdayRecords - минимальное количество событий в дне недели для анализа.
+// На разреженных выборках периодограмма дает случайные пики, поэтому такие дни пропускаются.
+const minWeekdayRecords = 30
+
+// detectWeekdayPeriods выполняет анализ по дням недели
+func detectWeekdayPeriods(times []time.Time, detector *periodDetector) map[time.Weekday][]PeriodResult {
+	weekdays := groupByWeekday(times)
+	results := make(map[time.Weekday][]PeriodResult)
+
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		times := weekdays[weekday]
+		if len(times) < minWeekdayRecords {
+			continue
+		}
+		results[weekday] = detector.detectScope(ScopeWeekday, weekday.String(), times)
+	}
+
+	return results
+}
+
+// groupByWeekday группирует временные метки по дням недели
+func groupByWeekday(times []time.Time) map[time.Weekday][]time.Time {
+	weekdays := make(map[time.Weekday][]time.Time)
+
+	for _, t := range times {
+		weekdays[t.Weekday()] = append(weekdays[t.Weekday()], t)
 	}
 
-	// Анализ всех данных
-	result.AllData.Daily = detector.detect(times)
-	result.AllData.Weekly = detector.detect(times)
-	result.AllData.AllTime = detector.detect(times)
+	return weekdays
+}
+
+// detectContinuousAll заполняет AllData и RecordCount результата непрерывного анализа
+// по всем меткам
+func detectContinuousAll(times []time.Time, detector *periodDetector, result *ContinuousResult) {
+	if len(times) == 0 {
+		return
+	}
+	result.AllData = detectWindowedPeriods(ScopeContinuousAll, times, detector)
 	result.RecordCount = len(times)
+}
+
+// detectContinuousLongest находит непрерывные отрезки упорядоченных по времени меток
+// и заполняет остальные поля результата непрерывного анализа по самому длинному из них.
+// Поля не пересекаются с detectContinuousAll, и обе функции могут выполняться параллельно.
+func detectContinuousLongest(times []time.Time, detector *periodDetector, result *ContinuousResult) {
+	if len(times) == 0 {
+		return
+	}
+
+	// Все непрерывные отрезки не короче MinSegmentDays
+	for _, segment := range findContinuousSegments(times, detector.config.maxGap()) {
+		if segment.Days >= detector.config.MinSegmentDays {
+			result.AllContinuousSegments = append(result.AllContinuousSegments, segment)
+		}
+	}
 
 	// Поиск самого длинного непрерывного периода
-	start, end, continuous := findLongestContinuousPeriod(times)
+	start, end, continuous := findLongestContinuousPeriod(times, detector.config.maxGap())
 	if len(continuous) > 0 {
 		result.Start = start
 		result.End = end
-		result.LongestContinuous.Daily = detector.detect(continuous)
-		result.LongestContinuous.Weekly = detector.detect(continuous)
-		result.LongestContinuous.AllTime = detector.detect(continuous)
+		result.LongestContinuous = detectWindowedPeriods(ScopeContinuousLongest, continuous, detector)
+		if detector.config.IncludeLongestContinuousRecords {
+			result.LongestContinuousRecords = toUnixMillis(continuous)
+		}
 	}
+}
 
-	return result
+// detectWindowedPeriods выполняет анализ Daily/Weekly/AllTime, привязывая окна к концу набора
+func detectWindowedPeriods(scope string, times []time.Time, detector *periodDetector) PeriodResults {
+	_, end := findDateRange(times)
+
+	return PeriodResults{
+		Daily:   detector.detectScope(scope, ScopeDaily, filterByTimeRange(times, end, dailyWindow)),
+		Weekly:  detector.detectScope(scope, ScopeWeekly, filterByTimeRange(times, end, detector.config.weeklyWindow())),
+		AllTime: detector.detectScope(scope, ScopeAllTime, times),
+	}
 }
 
 // findLongestContinuousPeriod находит самый длинный непрерывный период
-func findLongestContinuousPeriod(times []time.Time) (start, end time.Time, continuous []time.Time) {
+// (по количеству дней с событиями; при равенстве - самый ранний). Метки должны
+// быть упорядочены по времени.
+func findLongestContinuousPeriod(times []time.Time, maxGap time.Duration) (start, end time.Time, continuous []time.Time) {
 	if len(times) < 2 {
 		return time.Time{}, time.Time{}, times
 	}
 
-	// Сортируем временные метки
-	sort.Slice(times, func(i, j int) bool {
-		return times[i].Before(times[j])
-	})
+	// Ищем самый длинный непрерывный период
+	var longest Segment
+	for _, segment := range findContinuousSegments(times, maxGap) {
+		if segment.Days > longest.Days {
+			longest = segment
+		}
+	}
+
+	// Если не нашли подходящий период, возвращаем весь диапазон
+	if longest.Days == 0 {
+		return times[0], times[len(times)-1], times
+	}
+
+	// Собираем записи, входящие в непрерывный период
+	startLimit := longest.Start
+	endLimit := longest.End.Add(24 * time.Hour) // Включаем весь последний день
+	for _, t := range times {
+		if !t.Before(startLimit) && t.Before(endLimit) {
+			continuous = append(continuous, t)
+		}
+	}
+
+	return longest.Start, longest.End, continuous
+}
 
+// findContinuousSegments разбивает отсортированные метки на непрерывные отрезки:
+// соседние дни с событиями входят в один отрезок, если их начала отстоят не более
+// чем на maxGap
+func findContinuousSegments(times []time.Time, maxGap time.Duration) []Segment {
 	// Собираем уникальные дни
 	daySet := make(map[time.Time]struct{})
 	for _, t := range times {
@@ -442,69 +3100,39 @@ func findLongestContinuousPeriod(times []time.Time) (start, end time.Time, conti
 		return days[i].Before(days[j])
 	})
 
-	// Ищем самый длинный непрерывный период
-	var currentStart, currentEnd, maxStart, maxEnd time.Time
-	maxLength := 0
-	currentLength := 0
-
-	for i := 0; i < len(days); i++ {
-		if i == 0 {
-			currentStart = days[i]
-			currentEnd = days[i]
-			currentLength = 1
+	var segments []Segment
+	for i, day := range days {
+		if i > 0 && day.Sub(days[i-1]) <= maxGap {
+			current := &segments[len(segments)-1]
+			current.End = day
+			current.Days++
 			continue
 		}
-
-		gap := days[i].Sub(days[i-1]).Hours() / 24
-		if gap <= 2 { // Разрыв не более 2 дней
-			currentEnd = days[i]
-			currentLength++
-		} else {
-			if currentLength > maxLength {
-				maxStart = currentStart
-				maxEnd = currentEnd
-				maxLength = currentLength
-			}
-			currentStart = days[i]
-			currentEnd = days[i]
-			currentLength = 1
-		}
-	}
-
-	// Проверяем последний период
-	if currentLength > maxLength {
-		maxStart = currentStart
-		maxEnd = currentEnd
-		maxLength = currentLength
-	}
-
-	// Если не нашли подходящий период, возвращаем весь диапазон
-	if maxLength == 0 {
-		return times[0], times[len(times)-1], times
+		segments = append(segments, Segment{Start: day, End: day, Days: 1})
 	}
 
-	// Собираем записи, входящие в непрерывный период
-	startLimit := maxStart
-	endLimit := maxEnd.Add(24 * time.Hour) // Включаем весь последний день
-	for _, t := range times {
-		if !t.Before(startLimit) && t.Before(endLimit) {
-			continuous = append(continuous, t)
-		}
+	// Количество записей в каждом отрезке [Start, End + 24h)
+	for i := range segments {
+		from := sort.Search(len(times), func(j int) bool { return !times[j].Before(segments[i].Start) })
+		to := sort.Search(len(times), func(j int) bool { return !times[j].Before(segments[i].End.Add(24 * time.Hour)) })
+		segments[i].RecordCount = to - from
 	}
 
-	return maxStart, maxEnd, continuous
+	return segments
 }
 
-// aggregateByDay агрегирует данные по дням
-func aggregateByDay(times []time.Time) []DayRecord {
+// aggregateByDay агрегирует данные по дням. Если полный ряд длиннее maxBuckets
+// (при maxBuckets > 0), возвращаются только дни с событиями и признак sparse.
+func aggregateByDay(times []time.Time, maxBuckets int) (result []DayRecord, sparse bool) {
 	dateMap := make(map[time.Time]int)
 	for _, t := range times {
-		date := t.Truncate(24 * time.Hour)
+		// Полночь календарного дня в зоне метки, а не в UTC
+		date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
 		dateMap[date]++
 	}
 
 	if len(dateMap) == 0 {
-		return nil
+		return nil, false
 	}
 
 	// Определяем временной диапазон
@@ -518,37 +3146,80 @@ func aggregateByDay(times []time.Time) []DayRecord {
 		}
 	}
 
+	// Слишком длинный диапазон: только дни с событиями
+	if maxBuckets > 0 && int(math.Round(maxDate.Sub(minDate).Hours()/24))+1 > maxBuckets {
+		for date, count := range dateMap {
+			result = append(result, DayRecord{Date: date, Count: count, Rate: bucketRate(count, date, AggregateDay)})
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Date.Before(result[j].Date)
+		})
+		return result, true
+	}
+
 	// Генерируем полный ряд
-	var result []DayRecord
 	current := minDate
 	for !current.After(maxDate) {
 		count := dateMap[current]
 		result = append(result, DayRecord{
 			Date:  current,
 			Count: count,
+			Rate:  bucketRate(count, current, AggregateDay),
 		})
 		current = current.AddDate(0, 0, 1)
 	}
 
+	return result, false
+}
+
+// cumulativeDays возвращает ряд накопленных сумм по дням; Rate - средняя
+// интенсивность от начала ряда до конца дня
+func cumulativeDays(days []DayRecord) []DayRecord {
+	result := make([]DayRecord, len(days))
+	total := 0
+	for i, d := range days {
+		total += d.Count
+		result[i] = DayRecord{Date: d.Date, Count: total}
+		if hours := bucketEnd(d.Date, AggregateDay).Sub(days[0].Date).Hours(); hours > 0 {
+			result[i].Rate = float64(total) / hours
+		}
+	}
 	return result
 }
 
-// aggregateByWeek агрегирует данные по неделям
-func aggregateByWeek(times []time.Time) []WeekRecord {
+// smoothDays заполняет SmoothedCount центрированным скользящим средним по window
+// интервалам, сокращая окно у краев ряда
+func smoothDays(days []DayRecord, window int) {
+	// Префиксные суммы: сумма Count интервалов [i, j) - prefix[j] - prefix[i]
+	prefix := make([]int, len(days)+1)
+	for i, d := range days {
+		prefix[i+1] = prefix[i] + d.Count
+	}
+	before, after := (window-1)/2, window/2
+	for i := range days {
+		from, to := i-before, i+after+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(days) {
+			to = len(days)
+		}
+		days[i].SmoothedCount = float64(prefix[to]-prefix[from]) / float64(to-from)
+	}
+}
+
+// aggregateByWeek агрегирует данные по неделям, начинающимся с weekStartDay
+func aggregateByWeek(times []time.Time, weekStartDay time.Weekday) []WeekRecord {
 	weekMap := make(map[string]int)
 	weekStarts := make(map[string]time.Time)
 
 	for _, t := range times {
-		year, week := t.ISOWeek()
-		key := fmt.Sprintf("%d-W%02d", year, week)
-
-		// Вычисляем начало недели (понедельник)
-		weekday := int(t.Weekday())
-		if weekday == 0 {
-			weekday = 7 // Воскресенье -> 7
-		}
-		daysToMonday := weekday - 1
-		weekStart := t.AddDate(0, 0, -daysToMonday).Truncate(24 * time.Hour)
+		// Вычисляем начало недели как полночь календарного дня в зоне метки.
+		// Метка недели берется от этого начала, а не от t.ISOWeek(), поэтому
+		// на стыке годов (29 декабря - 2 января) метка и начало недели всегда согласованы.
+		daysToWeekStart := (int(t.Weekday()) - int(weekStartDay) + 7) % 7
+		weekStart := time.Date(t.Year(), t.Month(), t.Day()-daysToWeekStart, 0, 0, 0, 0, t.Location())
+		key := weekLabel(weekStart)
 
 		if _, exists := weekStarts[key]; !exists {
 			weekStarts[key] = weekStart
@@ -570,19 +3241,29 @@ func aggregateByWeek(times []time.Time) []WeekRecord {
 	// Формируем результат
 	var result []WeekRecord
 	for _, weekStart := range weeks {
-		year, week := weekStart.ISOWeek()
-		key := fmt.Sprintf("%d-W%02d", year, week)
+		key := weekLabel(weekStart)
 		result = append(result, WeekRecord{
-			Week:  weekStart,
-			Count: weekMap[key],
+			Week:    weekStart,
+			ISOWeek: key,
+			Count:   weekMap[key],
+			Rate:    bucketRate(weekMap[key], weekStart, AggregateWeek),
 		})
 	}
 
 	return result
 }
 
-// aggregateByMonth агрегирует данные по месяцам
-func aggregateByMonth(times []time.Time) []MonthRecord {
+// weekLabel возвращает метку ISO-недели, содержащей середину недели с началом weekStart.
+// Для недель с понедельника это в точности ISO-неделя; для недель с другого дня - та
+// ISO-неделя, с которой неделя пересекается больше всего.
+func weekLabel(weekStart time.Time) string {
+	year, week := weekStart.AddDate(0, 0, 3).ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// aggregateByMonth агрегирует данные по месяцам. Если полный ряд длиннее maxBuckets
+// (при maxBuckets > 0), возвращаются только месяцы с событиями и признак sparse.
+func aggregateByMonth(times []time.Time, maxBuckets int) (result []MonthRecord, sparse bool) {
 	monthMap := make(map[time.Time]int)
 	for _, t := range times {
 		month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
@@ -590,7 +3271,7 @@ func aggregateByMonth(times []time.Time) []MonthRecord {
 	}
 
 	if len(monthMap) == 0 {
-		return nil
+		return nil, false
 	}
 
 	// Определяем временной диапазон
@@ -604,19 +3285,31 @@ func aggregateByMonth(times []time.Time) []MonthRecord {
 		}
 	}
 
+	// Слишком длинный диапазон: только месяцы с событиями
+	monthCount := (maxMonth.Year()-minMonth.Year())*12 + int(maxMonth.Month()-minMonth.Month()) + 1
+	if maxBuckets > 0 && monthCount > maxBuckets {
+		for month, count := range monthMap {
+			result = append(result, MonthRecord{Month: month, Count: count, Rate: bucketRate(count, month, AggregateMonth)})
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i].Month.Before(result[j].Month)
+		})
+		return result, true
+	}
+
 	// Генерируем полный ряд
-	var result []MonthRecord
 	current := minMonth
 	for !current.After(maxMonth) {
 		count := monthMap[current]
 		result = append(result, MonthRecord{
 			Month: current,
 			Count: count,
+			Rate:  bucketRate(count, current, AggregateMonth),
 		})
 		current = current.AddDate(0, 1, 0)
 	}
 
-	return result
+	return result, false
 }
 
 // firstDayOfISOWeek возвращает первый день недели по ISO стандарту
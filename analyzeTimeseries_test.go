@@ -0,0 +1,582 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStart - начало синтетических рядов тестов
+var testStart = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// testConfig возвращает конфигурацию для почасовых рядов: периоды короче двух
+// часов выше предела Найквиста
+func testConfig() PeriodConfig {
+	config := DefaultPeriodConfig()
+	config.MinPeriod = 2
+	config.Location = time.UTC
+	config.SkipContinuous = true
+	return config
+}
+
+// containsWarning проверяет, что одно из предупреждений содержит substr
+func containsWarning(warnings []string, substr string) bool {
+	for _, w := range warnings {
+		if strings.Contains(w, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hourlySamples возвращает измерения каждый час в течение days дней
+func hourlySamples(days int, sample func(hours float64) (value, sigma float64)) []Sample {
+	samples := make([]Sample, 0, days*24)
+	for h := 0; h < days*24; h++ {
+		value, sigma := sample(float64(h))
+		samples = append(samples, Sample{
+			Time:  testStart.Add(time.Duration(h) * time.Hour).UnixMilli(),
+			Value: value,
+			Sigma: sigma,
+		})
+	}
+	return samples
+}
+
+func TestContinuousAllDataUsesWindows(t *testing.T) {
+	// Суточный цикл 23 дня, затем шесть дней 12-часового и последние сутки 4-часового
+	var timestamps []int64
+	for h := 0; h < 30*24; h++ {
+		period := 24.0
+		switch {
+		case h >= 29*24:
+			period = 4
+		case h >= 23*24:
+			period = 12
+		}
+		n := int(math.Round(3 + 3*math.Sin(2*math.Pi*float64(h)/period)))
+		for k := 0; k < n; k++ {
+			timestamps = append(timestamps, testStart.Add(time.Duration(h)*time.Hour+time.Duration(k)*time.Minute).UnixMilli())
+		}
+	}
+
+	config := testConfig()
+	config.SkipContinuous = false
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := result.Continuous.AllData
+	if len(all.Daily) == 0 || len(all.Weekly) == 0 || len(all.AllTime) == 0 {
+		t.Fatalf("empty continuous allData: %+v", all)
+	}
+	if reflect.DeepEqual(all.Daily, all.Weekly) || reflect.DeepEqual(all.Weekly, all.AllTime) || reflect.DeepEqual(all.Daily, all.AllTime) {
+		t.Error("daily, weekly and allTime of continuous allData must come from different windows")
+	}
+	if p := all.Daily[0].Period; p > 20 {
+		t.Errorf("daily top period = %g hours, want a short one from the last day", p)
+	}
+	if p := all.AllTime[0].Period; math.Abs(p-24) > 0.5 {
+		t.Errorf("allTime top period = %g hours, want 24", p)
+	}
+}
+
+// BenchmarkComputePeriodogram сравнивает выделения памяти на квартал при буферах из
+// spectrumPool и при новых буферах для каждой периодограммы
+func BenchmarkComputePeriodogram(b *testing.B) {
+	pd := newPeriodDetector(testConfig())
+	times := make([]float64, 90*24)
+	for i := range times {
+		times[i] = float64(i)
+	}
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := spectrumPool.Get().(*spectrumBuffers)
+			pd.computePeriodogram(times, nil, nil, 0, 2, 720, buf)
+			spectrumPool.Put(buf)
+		}
+	})
+	b.Run("fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			pd.computePeriodogram(times, nil, nil, 0, 2, 720, &spectrumBuffers{})
+		}
+	})
+}
+
+func TestWeekLabelAtYearBoundary(t *testing.T) {
+	// 29 декабря 2025 - понедельник первой ISO-недели 2026 года
+	var times []time.Time
+	for _, day := range []int{28, 29, 30, 31, 32, 33, 36} {
+		times = append(times, time.Date(2025, 12, day, 12, 0, 0, 0, time.UTC))
+	}
+
+	want := []WeekRecord{
+		{Week: time.Date(2025, 12, 22, 0, 0, 0, 0, time.UTC), ISOWeek: "2025-W52", Count: 1},
+		{Week: time.Date(2025, 12, 29, 0, 0, 0, 0, time.UTC), ISOWeek: "2026-W01", Count: 5},
+		{Week: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), ISOWeek: "2026-W02", Count: 1},
+	}
+	weeks := aggregateByWeek(times, time.Monday)
+	if len(weeks) != len(want) {
+		t.Fatalf("got %d weeks, want %d: %+v", len(weeks), len(want), weeks)
+	}
+	for i, w := range weeks {
+		if !w.Week.Equal(want[i].Week) || w.ISOWeek != want[i].ISOWeek || w.Count != want[i].Count {
+			t.Errorf("week %d = %v %s %d, want %v %s %d", i, w.Week, w.ISOWeek, w.Count, want[i].Week, want[i].ISOWeek, want[i].Count)
+		}
+	}
+}
+
+func TestFilterByTimeRangeIncludesEdges(t *testing.T) {
+	end := testStart.Add(48 * time.Hour)
+	start := end.Add(-24 * time.Hour)
+	limit := end.Add(24 * time.Hour)
+	times := []time.Time{
+		start.Add(-time.Millisecond), start, end, limit, limit.Add(time.Millisecond),
+	}
+
+	got := filterByTimeRange(times, end, 24*time.Hour)
+	want := []time.Time{start, end, limit}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("filterByTimeRange = %v, want %v", got, want)
+	}
+}
+
+func TestQuarterBoundariesInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+9", 9*60*60)
+	boundaries := []struct {
+		month         time.Month
+		before, after string
+	}{
+		{time.January, "2022-Q4", "2023-Q1"},
+		{time.April, "2023-Q1", "2023-Q2"},
+		{time.July, "2023-Q2", "2023-Q3"},
+		{time.October, "2023-Q3", "2023-Q4"},
+	}
+	for _, b := range boundaries {
+		// Метки передаются в UTC: квартал определяется полночью по loc, а не по UTC
+		at := time.Date(2023, b.month, 1, 0, 0, 0, 0, loc).UTC()
+		before := at.Add(-time.Nanosecond)
+		quarters := groupByQuarter([]time.Time{before, at}, loc)
+		if got := quarters[b.before]; len(got) != 1 || !got[0].Equal(before) {
+			t.Errorf("%v: %s = %v, want the instant before midnight", b.month, b.before, got)
+		}
+		if got := quarters[b.after]; len(got) != 1 || !got[0].Equal(at) {
+			t.Errorf("%v: %s = %v, want midnight itself", b.month, b.after, got)
+		}
+	}
+}
+
+func TestDetectReportsZeroSpan(t *testing.T) {
+	times := make([]time.Time, 10)
+	for i := range times {
+		times[i] = testStart
+	}
+
+	pd := newPeriodDetector(testConfig())
+	periods, err := pd.detect(ScopeAllTime, times, 2, 100, 3, nil)
+	if !errors.Is(err, errZeroSpan) {
+		t.Fatalf("detect error = %v, want errZeroSpan", err)
+	}
+	if len(periods) > 0 {
+		t.Errorf("periods detected with zero span: %+v", periods)
+	}
+}
+
+// TestParallelScopesMatchSequential сравнивает параллельный и последовательный анализ
+// областей; запускайте с -race, чтобы проверить отсутствие гонок
+func TestParallelScopesMatchSequential(t *testing.T) {
+	// Полгода с пропуском: несколько кварталов и непрерывных отрезков
+	var timestamps []int64
+	for h := 0; h < 180*24; h += 3 {
+		if h >= 60*24 && h < 70*24 {
+			continue
+		}
+		timestamps = append(timestamps, testStart.Add(time.Duration(h)*time.Hour+time.Duration(h%7)*time.Minute).UnixMilli())
+	}
+	// Метки не по порядку: анализ не должен сортировать входной срез на месте
+	timestamps[0], timestamps[len(timestamps)-1] = timestamps[len(timestamps)-1], timestamps[0]
+	input := append([]int64(nil), timestamps...)
+
+	config := testConfig()
+	config.SkipContinuous = false
+	config.Parallelism = 1
+	sequential, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Parallelism = 8
+	parallel, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(parallel.Periods, sequential.Periods) {
+		t.Error("parallel periods differ from sequential")
+	}
+	if !reflect.DeepEqual(parallel.Continuous, sequential.Continuous) {
+		t.Error("parallel continuous result differs from sequential")
+	}
+	if !reflect.DeepEqual(timestamps, input) {
+		t.Error("input timestamps were modified")
+	}
+}
+
+func TestMinCyclesDropsLongPeriods(t *testing.T) {
+	// Десять дней с циклом 96 часов: в данных всего 2.5 цикла
+	var timestamps []int64
+	for h := 0; h < 10*24; h++ {
+		n := int(math.Round(3 + 3*math.Sin(2*math.Pi*float64(h)/96)))
+		for k := 0; k < n; k++ {
+			timestamps = append(timestamps, testStart.Add(time.Duration(h)*time.Hour+time.Duration(k)*time.Minute).UnixMilli())
+		}
+	}
+	span := time.Duration(timestamps[len(timestamps)-1]-timestamps[0]) * time.Millisecond
+
+	config := testConfig()
+	config.MinCycles = 0
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Periods.AllTime) == 0 || math.Abs(result.Periods.AllTime[0].Period-96) > 10 {
+		t.Fatalf("without MinCycles allTime = %+v, want a 96-hour period", result.Periods.AllTime)
+	}
+
+	config.MinCycles = 4
+	if result, err = AnalyzeTimestamps(timestamps, config); err != nil {
+		t.Fatal(err)
+	}
+	limit := span.Hours() / config.MinCycles
+	if r := result.EffectivePeriodRanges[ScopeAllTime]; r.Max > limit {
+		t.Errorf("allTime maxPeriod = %g hours, want at most %g", r.Max, limit)
+	}
+	for _, p := range result.Periods.AllTime {
+		if p.Period > limit {
+			t.Errorf("period %g hours kept with fewer than %g cycles in %g hours", p.Period, config.MinCycles, span.Hours())
+		}
+	}
+
+	// detect отбрасывает длинные периоды и при диапазоне шире ограничения области
+	times := make([]time.Time, len(timestamps))
+	for i, ts := range timestamps {
+		times[i] = time.UnixMilli(ts).UTC()
+	}
+	pd := newPeriodDetector(config)
+	periods, err := pd.detect(ScopeAllTime, times, 2, span.Hours(), 3, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range periods {
+		if p.Period > limit {
+			t.Errorf("detect kept period %g hours, limit %g", p.Period, limit)
+		}
+	}
+	if !containsWarning(pd.warnings, "allTime: dropped periods longer than") {
+		t.Errorf("no dropped periods warning in %q", pd.warnings)
+	}
+}
+
+func TestSortPeaksByPowerBreaksTiesByIndex(t *testing.T) {
+	powers := []float64{0, 5, 3, 5, 0, 3, 5, 1}
+	want := []int{1, 3, 6, 2, 5, 7}
+	for _, peaks := range [][]int{{1, 2, 3, 5, 6, 7}, {7, 6, 5, 3, 2, 1}, {5, 3, 7, 1, 6, 2}} {
+		sortPeaksByPower(peaks, powers)
+		if !reflect.DeepEqual(peaks, want) {
+			t.Errorf("sortPeaksByPower = %v, want %v", peaks, want)
+		}
+	}
+}
+
+func TestAnalyzeMeasurementsIgnoresPeriodicSigma(t *testing.T) {
+	samples := hourlySamples(28, func(h float64) (float64, float64) {
+		return 5, 1 + 0.5*math.Sin(2*math.Pi*h/24)
+	})
+
+	result, err := AnalyzeMeasurements(samples, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for scope, periods := range map[string][]PeriodResult{
+		ScopeDaily:   result.Periods.Daily,
+		ScopeWeekly:  result.Periods.Weekly,
+		ScopeAllTime: result.Periods.AllTime,
+	} {
+		if len(periods) > 0 {
+			t.Errorf("%s: constant values gave periods %+v", scope, periods)
+		}
+	}
+}
+
+func TestAnalyzeMeasurementsFindsPeriodicValue(t *testing.T) {
+	samples := hourlySamples(28, func(h float64) (float64, float64) {
+		return 10 + math.Sin(2*math.Pi*h/24), 0.5
+	})
+
+	result, err := AnalyzeMeasurements(samples, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Periods.AllTime) == 0 {
+		t.Fatal("no allTime periods")
+	}
+	if p := result.Periods.AllTime[0].Period; math.Abs(p-24) > 0.5 {
+		t.Errorf("top period = %g hours, want 24", p)
+	}
+}
+
+func TestAnalyzeMeasurementsSkipsNonPositiveSigma(t *testing.T) {
+	samples := hourlySamples(7, func(h float64) (float64, float64) {
+		return math.Sin(2 * math.Pi * h / 24), 1
+	})
+	samples[0].Sigma, samples[1].Sigma = 0, -1
+
+	result, err := AnalyzeMeasurements(samples, testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalRecords != len(samples)-2 {
+		t.Errorf("TotalRecords = %d, want %d", result.TotalRecords, len(samples)-2)
+	}
+}
+
+func TestPoissonBinsFindDailyPeriod(t *testing.T) {
+	// Интенсивность меняется по суткам от 0 до 6 событий в час
+	var timestamps []int64
+	for h := 0; h < 28*24; h++ {
+		n := int(math.Round(3 + 3*math.Sin(2*math.Pi*float64(h)/24)))
+		for k := 0; k < n; k++ {
+			timestamps = append(timestamps, testStart.Add(time.Duration(h)*time.Hour+time.Duration(k)*time.Minute).UnixMilli())
+		}
+	}
+
+	config := testConfig()
+	config.BinWidth = time.Hour
+	config.NoiseModel = NoisePoisson
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Periods.AllTime) == 0 {
+		t.Fatal("no allTime periods")
+	}
+	if p := result.Periods.AllTime[0].Period; math.Abs(p-24) > 0.5 {
+		t.Errorf("top period = %g hours, want 24", p)
+	}
+}
+
+func TestBinWidthRejectsTooManyBins(t *testing.T) {
+	timestamps := []int64{
+		testStart.UnixMilli(),
+		testStart.Add(time.Hour).UnixMilli(),
+		testStart.AddDate(1, 0, 0).UnixMilli(),
+	}
+
+	config := testConfig()
+	config.BinWidth = time.Millisecond
+	if _, err := AnalyzeTimestamps(timestamps, config); err == nil {
+		t.Fatal("expected an error for a year of millisecond bins")
+	}
+}
+
+func TestRollingWindowCountMatchesWindows(t *testing.T) {
+	samples := hourlySamples(10, func(h float64) (float64, float64) { return 0, 1 })
+	timestamps := make([]int64, len(samples))
+	for i, s := range samples {
+		timestamps[i] = s.Time
+	}
+
+	config := testConfig()
+	config.RollingWindow = 48 * time.Hour
+	config.RollingStep = 12 * time.Hour
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	span := time.Duration(timestamps[len(timestamps)-1]-timestamps[0]) * time.Millisecond
+	if n := rollingWindowCount(span, config.RollingWindow, config.RollingStep); int(n) != len(result.Rolling) {
+		t.Errorf("rollingWindowCount = %d, got %d windows", n, len(result.Rolling))
+	}
+
+	config.RollingStep = time.Second
+	if _, err := AnalyzeTimestamps(timestamps, config); err == nil {
+		t.Error("expected an error for too many rolling windows")
+	}
+}
+
+func TestAdaptiveGridRespectsFrequencyCap(t *testing.T) {
+	config := DefaultPeriodConfig()
+	config.Adaptive = true
+	config.SamplesPerPeak = 50
+	pd := newPeriodDetector(config)
+
+	// Год данных и периоды от 6 минут до года: пять декад, каждой нужно больше maxFrequencies
+	counts, total, _ := pd.adaptiveBands(8760, 1/config.MaxPeriod, 1/config.MinPeriod)
+	if total > maxFrequencies {
+		t.Errorf("adaptive grid has %d frequencies, more than %d", total, maxFrequencies)
+	}
+	sum := 0
+	for _, n := range counts {
+		if n < minFrequencies {
+			t.Errorf("band has %d frequencies, fewer than %d", n, minFrequencies)
+		}
+		sum += n
+	}
+	if sum != total {
+		t.Errorf("band counts sum to %d, total is %d", sum, total)
+	}
+}
+
+func TestDeadlineUsesClock(t *testing.T) {
+	samples := hourlySamples(14, func(h float64) (float64, float64) { return 0, 1 })
+	timestamps := make([]int64, len(samples))
+	for i, s := range samples {
+		timestamps[i] = s.Time
+	}
+
+	// Каждое обращение к часам сдвигает время на час, поэтому срок в минуту истекает
+	// при первой же проверке
+	now := testStart
+	config := testConfig()
+	config.Parallelism = 1
+	config.Deadline = time.Minute
+	config.Clock = func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	}
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Periods.AllTime) > 0 || len(result.Periods.Daily) > 0 {
+		t.Errorf("periods detected after the deadline: %+v", result.Periods)
+	}
+}
+
+func TestCollapsedRangeIsReported(t *testing.T) {
+	// Шесть часов данных: предел длительности 3 часа ниже MinPeriod в 4 часа
+	var timestamps []int64
+	for m := 0; m <= 360; m += 10 {
+		timestamps = append(timestamps, testStart.Add(time.Duration(m)*time.Minute).UnixMilli())
+	}
+
+	config := testConfig()
+	config.MinPeriod = 4
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := result.EffectivePeriodRanges[ScopeAllTime]
+	if !ok {
+		t.Fatal("allTime missing from EffectivePeriodRanges")
+	}
+	if r.Min < r.Max {
+		t.Errorf("allTime range = %+v, want a collapsed range", r)
+	}
+	if !containsWarning(result.Warnings, "allTime: period range collapsed") {
+		t.Errorf("no collapsed range warning in %q", result.Warnings)
+	}
+}
+
+func TestZeroWeekStartMeansMonday(t *testing.T) {
+	// 2023-06-01 - четверг; неделя с понедельника начинается 2023-05-29
+	buckets, err := AggregateTimestamps([]int64{testStart.UnixMilli()}, AggregateWeek, PeriodConfig{Location: time.UTC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2023, 5, 29, 0, 0, 0, 0, time.UTC)
+	if len(buckets) != 1 || !buckets[0].Start.Equal(want) {
+		t.Fatalf("week buckets %+v, want one starting at %v", buckets, want)
+	}
+
+	sunday := time.Sunday
+	config := PeriodConfig{Location: time.UTC, WeekStart: &sunday}
+	if buckets, err = AggregateTimestamps([]int64{testStart.UnixMilli()}, AggregateWeek, config); err != nil {
+		t.Fatal(err)
+	}
+	if want = want.AddDate(0, 0, -1); len(buckets) != 1 || !buckets[0].Start.Equal(want) {
+		t.Fatalf("week buckets %+v, want one starting at %v", buckets, want)
+	}
+}
+
+func TestEffectiveConfigKeepsTimezone(t *testing.T) {
+	var timestamps []int64
+	for h := 0; h < 14*24; h++ {
+		timestamps = append(timestamps, testStart.Add(time.Duration(h)*time.Hour).UnixMilli())
+	}
+	config := testConfig()
+	config.Location = nil
+	config.Timezone = "Asia/Tokyo"
+	config.ScopeNumPeriods = map[string]int{ScopeDaily: 2}
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Days) == 0 || result.Days[0].Date.Location().String() != "Asia/Tokyo" {
+		t.Fatalf("days are not in Asia/Tokyo: %+v", result.Days)
+	}
+
+	// Часовой пояс переживает сериализацию EffectiveConfig
+	data, err := json.Marshal(result.EffectiveConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PeriodConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Timezone != "Asia/Tokyo" {
+		t.Errorf("decoded Timezone = %q, want Asia/Tokyo", decoded.Timezone)
+	}
+
+	// EffectiveConfig не разделяет карты с конфигурацией вызывающего
+	result.EffectiveConfig.ScopeNumPeriods[ScopeDaily] = 5
+	if config.ScopeNumPeriods[ScopeDaily] != 2 {
+		t.Errorf("caller's ScopeNumPeriods changed through EffectiveConfig: %v", config.ScopeNumPeriods)
+	}
+
+	config.Timezone = "Nowhere/Invalid"
+	if _, err := AnalyzeTimestamps(timestamps, config); err == nil {
+		t.Error("invalid Timezone accepted")
+	}
+}
+
+func TestExplicitPeriodBoundsOverrideDefaultScopeRanges(t *testing.T) {
+	var timestamps []int64
+	for m := 0; m < 30*24*60; m += 15 {
+		timestamps = append(timestamps, testStart.Add(time.Duration(m)*time.Minute).UnixMilli())
+	}
+	tests := []struct {
+		name          string
+		minPeriod     float64
+		maxPeriod     float64
+		daily, weekly PeriodRange
+	}{
+		// Окно daily - 72 часа, поэтому его верхняя граница не выше 36 часов
+		{"defaults", 0.1, 8760, PeriodRange{Min: 1, Max: 36}, PeriodRange{Min: 12, Max: 336}},
+		{"maxPeriod", 0.1, 30, PeriodRange{Min: 1, Max: 30}, PeriodRange{Min: 12, Max: 30}},
+		{"minPeriod", 0.5, 8760, PeriodRange{Min: 0.5, Max: 36}, PeriodRange{Min: 0.5, Max: 336}},
+	}
+	for _, tt := range tests {
+		config := DefaultPeriodConfig()
+		config.MinPeriod, config.MaxPeriod = tt.minPeriod, tt.maxPeriod
+		config.Location = time.UTC
+		config.SkipContinuous = true
+		result, err := AnalyzeTimestamps(timestamps, config)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := result.EffectivePeriodRanges[ScopeDaily]; got != tt.daily {
+			t.Errorf("%s: daily range = %+v, want %+v", tt.name, got, tt.daily)
+		}
+		if got := result.EffectivePeriodRanges[ScopeWeekly]; got != tt.weekly {
+			t.Errorf("%s: weekly range = %+v, want %+v", tt.name, got, tt.weekly)
+		}
+	}
+}
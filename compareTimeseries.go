@@ -0,0 +1,151 @@
+package timeseries
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultPeriodTolerance - относительный допуск по умолчанию, при котором два периода
+// считаются одинаковыми: при 5% совпадают 24.0h и 24.5h, но не 24.0h и 168.0h
+const DefaultPeriodTolerance = 0.05
+
+// ComparisonResult содержит различия периодичности двух наборов данных
+type ComparisonResult struct {
+	Matched []PeriodDelta  `json:"matched"` // Периоды, найденные в обоих наборах
+	OnlyInA []PeriodResult `json:"onlyInA"` // Периоды, найденные только в A
+	OnlyInB []PeriodResult `json:"onlyInB"` // Периоды, найденные только в B
+}
+
+// PeriodDelta описывает изменение совпавшего периода между наборами A и B
+type PeriodDelta struct {
+	PeriodA           float64 `json:"periodA"`
+	PeriodB           float64 `json:"periodB"`
+	PowerDelta        float64 `json:"powerDelta"`        // Мощность B минус мощность A
+	SignificanceDelta float64 `json:"significanceDelta"` // Значимость B минус значимость A
+}
+
+// CompareAnalyses сопоставляет периоды allTime двух анализов с допуском DefaultPeriodTolerance
+func CompareAnalyses(a, b *AnalysisResult) ComparisonResult {
+	return CompareAnalysesWithin(a, b, DefaultPeriodTolerance)
+}
+
+// CompareAnalysesWithin сопоставляет периоды allTime двух анализов с относительным
+// допуском tolerance (см. PeriodConfig.PeriodTolerance). При tolerance <= 0
+// используется DefaultPeriodTolerance.
+func CompareAnalysesWithin(a, b *AnalysisResult, tolerance float64) ComparisonResult {
+	var periodsA, periodsB []PeriodResult
+	if a != nil {
+		periodsA = a.Periods.AllTime
+	}
+	if b != nil {
+		periodsB = b.Periods.AllTime
+	}
+
+	return comparePeriods(periodsA, periodsB, effectiveTolerance(tolerance))
+}
+
+// comparePeriods сопоставляет два списка периодов, начиная с самых мощных пиков A
+func comparePeriods(periodsA, periodsB []PeriodResult, tolerance float64) ComparisonResult {
+	orderA := make([]int, len(periodsA))
+	for i := range orderA {
+		orderA[i] = i
+	}
+	sort.Slice(orderA, func(i, j int) bool {
+		return periodsA[orderA[i]].Power > periodsA[orderA[j]].Power
+	})
+
+	result := ComparisonResult{}
+	usedB := make([]bool, len(periodsB))
+
+	for _, i := range orderA {
+		pa := periodsA[i]
+
+		// Ищем ближайший несопоставленный период B в пределах допуска
+		best := -1
+		for j, pb := range periodsB {
+			if usedB[j] || !periodsMatch(pa.Period, pb.Period, tolerance) {
+				continue
+			}
+			if best < 0 || math.Abs(pb.Period-pa.Period) < math.Abs(periodsB[best].Period-pa.Period) {
+				best = j
+			}
+		}
+
+		if best < 0 {
+			result.OnlyInA = append(result.OnlyInA, pa)
+			continue
+		}
+
+		usedB[best] = true
+		pb := periodsB[best]
+		result.Matched = append(result.Matched, PeriodDelta{
+			PeriodA:           pa.Period,
+			PeriodB:           pb.Period,
+			PowerDelta:        pb.Power - pa.Power,
+			SignificanceDelta: pb.Significance - pa.Significance,
+		})
+	}
+
+	for j, pb := range periodsB {
+		if !usedB[j] {
+			result.OnlyInB = append(result.OnlyInB, pb)
+		}
+	}
+
+	return result
+}
+
+// periodsMatch проверяет, совпадают ли периоды с относительным допуском:
+// разница не должна превышать долю tolerance от меньшего из периодов
+func periodsMatch(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance*math.Min(a, b)
+}
+
+// effectiveTolerance заменяет неположительный допуск значением по умолчанию
+func effectiveTolerance(tolerance float64) float64 {
+	if tolerance <= 0 {
+		return DefaultPeriodTolerance
+	}
+	return tolerance
+}
+
+// Combined объединяет периоды Daily, Weekly и AllTime в один список, отсортированный
+// по значимости. Из периодов, совпадающих в пределах DefaultPeriodTolerance, остается самый значимый.
+func (pr PeriodResults) Combined() []PeriodResult {
+	return pr.CombinedWithin(DefaultPeriodTolerance)
+}
+
+// CombinedWithin работает как Combined с относительным допуском tolerance
+// (при tolerance <= 0 используется DefaultPeriodTolerance)
+func (pr PeriodResults) CombinedWithin(tolerance float64) []PeriodResult {
+	var all []PeriodResult
+	all = append(all, pr.Daily...)
+	all = append(all, pr.Weekly...)
+	all = append(all, pr.AllTime...)
+
+	return mergePeriods(all, effectiveTolerance(tolerance))
+}
+
+// mergePeriods удаляет совпадающие периоды, оставляя самые значимые
+func mergePeriods(periods []PeriodResult, tolerance float64) []PeriodResult {
+	sorted := append([]PeriodResult(nil), periods...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Significance > sorted[j].Significance
+	})
+
+	var merged []PeriodResult
+	for _, candidate := range sorted {
+		duplicate := false
+		for _, kept := range merged {
+			if periodsMatch(candidate.Period, kept.Period, tolerance) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, candidate)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"AT/timeseries"
+	"encoding/json"
+	"flag"
+	"os"
+)
+
+// configFlagOverrides переносит значение явно заданного флага в конфигурацию,
+// загруженную из файла -config
+var configFlagOverrides = map[string]func(dst, src *timeseries.PeriodConfig){
+	"min-period":            func(dst, src *timeseries.PeriodConfig) { dst.MinPeriod = src.MinPeriod },
+	"max-period":            func(dst, src *timeseries.PeriodConfig) { dst.MaxPeriod = src.MaxPeriod },
+	"num-periods":           func(dst, src *timeseries.PeriodConfig) { dst.NumPeriods = src.NumPeriods },
+	"samples-per-peak":      func(dst, src *timeseries.PeriodConfig) { dst.SamplesPerPeak = src.SamplesPerPeak },
+	"weekdays":              func(dst, src *timeseries.PeriodConfig) { dst.ByWeekday = src.ByWeekday },
+	"skip-continuous":       func(dst, src *timeseries.PeriodConfig) { dst.SkipContinuous = src.SkipContinuous },
+	"skip-aggregation":      func(dst, src *timeseries.PeriodConfig) { dst.SkipAggregation = src.SkipAggregation },
+	"min-prominence":        func(dst, src *timeseries.PeriodConfig) { dst.MinProminence = src.MinProminence },
+	"model":                 func(dst, src *timeseries.PeriodConfig) { dst.Model = src.Model },
+	"include-scope-samples": func(dst, src *timeseries.PeriodConfig) { dst.IncludeScopeSamples = src.IncludeScopeSamples },
+	"spectrum-scopes":       func(dst, src *timeseries.PeriodConfig) { dst.SpectrumScopes = src.SpectrumScopes },
+	"week-start":            func(dst, src *timeseries.PeriodConfig) { dst.WeekStart = src.WeekStart },
+	"period-tolerance":      func(dst, src *timeseries.PeriodConfig) { dst.PeriodTolerance = src.PeriodTolerance },
+	"jitter":                func(dst, src *timeseries.PeriodConfig) { dst.Jitter = src.Jitter },
+	"anchor-now":            func(dst, src *timeseries.PeriodConfig) { dst.AnchorToNow = src.AnchorToNow },
+	"adaptive":              func(dst, src *timeseries.PeriodConfig) { dst.Adaptive = src.Adaptive },
+	"seed":                  func(dst, src *timeseries.PeriodConfig) { dst.Seed = src.Seed },
+
+	"business-hours":          func(dst, src *timeseries.PeriodConfig) { dst.BusinessHours = src.BusinessHours },
+	"scope-num-periods":       func(dst, src *timeseries.PeriodConfig) { dst.ScopeNumPeriods = src.ScopeNumPeriods },
+	"max-operations":          func(dst, src *timeseries.PeriodConfig) { dst.MaxOperations = src.MaxOperations },
+	"reference-period":        func(dst, src *timeseries.PeriodConfig) { dst.ReferencePeriod = src.ReferencePeriod },
+	"peak-neighborhood":       func(dst, src *timeseries.PeriodConfig) { dst.PeakNeighborhood = src.PeakNeighborhood },
+	"parallelism":             func(dst, src *timeseries.PeriodConfig) { dst.Parallelism = src.Parallelism },
+	"cumulative":              func(dst, src *timeseries.PeriodConfig) { dst.Cumulative = src.Cumulative },
+	"exclude-periods":         func(dst, src *timeseries.PeriodConfig) { dst.ExcludePeriods = src.ExcludePeriods },
+	"min-cycles":              func(dst, src *timeseries.PeriodConfig) { dst.MinCycles = src.MinCycles },
+	"weekly-window":           func(dst, src *timeseries.PeriodConfig) { dst.WeeklyWindow = src.WeeklyWindow },
+	"rolling-window":          func(dst, src *timeseries.PeriodConfig) { dst.RollingWindow = src.RollingWindow },
+	"rolling-step":            func(dst, src *timeseries.PeriodConfig) { dst.RollingStep = src.RollingStep },
+	"max-gap":                 func(dst, src *timeseries.PeriodConfig) { dst.MaxGap = src.MaxGap },
+	"min-segment-days":        func(dst, src *timeseries.PeriodConfig) { dst.MinSegmentDays = src.MinSegmentDays },
+	"spectrum-preview-bins":   func(dst, src *timeseries.PeriodConfig) { dst.SpectrumPreviewBins = src.SpectrumPreviewBins },
+	"assume-sorted":           func(dst, src *timeseries.PeriodConfig) { dst.AssumeSorted = src.AssumeSorted },
+	"scope-period-ranges":     func(dst, src *timeseries.PeriodConfig) { dst.ScopePeriodRanges = src.ScopePeriodRanges },
+	"bin-width":               func(dst, src *timeseries.PeriodConfig) { dst.BinWidth = src.BinWidth },
+	"include-binned-series":   func(dst, src *timeseries.PeriodConfig) { dst.IncludeBinnedSeries = src.IncludeBinnedSeries },
+	"noise-model":             func(dst, src *timeseries.PeriodConfig) { dst.NoiseModel = src.NoiseModel },
+	"cumulative-significance": func(dst, src *timeseries.PeriodConfig) { dst.CumulativeSignificance = src.CumulativeSignificance },
+	"refine-peaks":            func(dst, src *timeseries.PeriodConfig) { dst.RefinePeaks = src.RefinePeaks },
+	"sample-fraction":         func(dst, src *timeseries.PeriodConfig) { dst.SampleFraction = src.SampleFraction },
+	"months":                  func(dst, src *timeseries.PeriodConfig) { dst.ByMonth = src.ByMonth },
+	"month-keys":              func(dst, src *timeseries.PeriodConfig) { dst.MonthKeyFormat = src.MonthKeyFormat },
+	"fundamental":             func(dst, src *timeseries.PeriodConfig) { dst.Fundamental = src.Fundamental },
+	"describe":                func(dst, src *timeseries.PeriodConfig) { dst.Describe = src.Describe },
+	"min-quarter-records":     func(dst, src *timeseries.PeriodConfig) { dst.MinQuarterRecords = src.MinQuarterRecords },
+	"smoothing-window":        func(dst, src *timeseries.PeriodConfig) { dst.SmoothingWindow = src.SmoothingWindow },
+	"include-raw-components":  func(dst, src *timeseries.PeriodConfig) { dst.IncludeRawComponents = src.IncludeRawComponents },
+	"edge-exclusion-bins":     func(dst, src *timeseries.PeriodConfig) { dst.EdgeExclusionBins = src.EdgeExclusionBins },
+	"deadline":                func(dst, src *timeseries.PeriodConfig) { dst.Deadline = src.Deadline },
+	"max-aggregation-buckets": func(dst, src *timeseries.PeriodConfig) { dst.MaxAggregationBuckets = src.MaxAggregationBuckets },
+
+	"timezone": func(dst, src *timeseries.PeriodConfig) {
+		dst.Location, dst.Timezone = src.Location, src.Timezone
+	},
+
+	"include-longest-records": func(dst, src *timeseries.PeriodConfig) {
+		dst.IncludeLongestContinuousRecords = src.IncludeLongestContinuousRecords
+	},
+}
+
+// loadConfigFile загружает PeriodConfig из JSON-файла. Поля, отсутствующие в файле,
+// берутся из flagConfig, а явно заданные флаги переопределяют значения из файла.
+func loadConfigFile(filename string, flagConfig timeseries.PeriodConfig) (timeseries.PeriodConfig, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return flagConfig, err
+	}
+	defer file.Close()
+
+	config := flagConfig
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return flagConfig, err
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		if override, ok := configFlagOverrides[f.Name]; ok {
+			override(&config, &flagConfig)
+		}
+	})
+
+	return config, nil
+}
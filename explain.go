@@ -0,0 +1,87 @@
+package main
+
+import (
+	"AT/timeseries"
+	"fmt"
+	"io"
+	"math"
+)
+
+// namedCycle - календарный цикл, с которым сопоставляются найденные периоды
+type namedCycle struct {
+	name  string
+	hours float64
+}
+
+// namedCycles перечислены по возрастанию длительности; месяц, квартал и год - средние
+var namedCycles = []namedCycle{
+	{"hourly", 1},
+	{"daily", 24},
+	{"weekly", 168},
+	{"monthly", 730.5},
+	{"quarterly", 2191.5},
+	{"yearly", 8766},
+}
+
+// cycleTolerance - относительное отклонение, в пределах которого период считается
+// совпадающим с календарным циклом
+const cycleTolerance = 0.1
+
+// explainPeriods выводит для каждого найденного периода областей daily, weekly и
+// allTime описание на естественном языке для неспециалистов
+func explainPeriods(w io.Writer, periods timeseries.PeriodResults) {
+	scopes := []struct {
+		name    string
+		periods []timeseries.PeriodResult
+	}{
+		{timeseries.ScopeDaily, periods.Daily},
+		{timeseries.ScopeWeekly, periods.Weekly},
+		{timeseries.ScopeAllTime, periods.AllTime},
+	}
+
+	for _, scope := range scopes {
+		if len(scope.periods) == 0 {
+			fmt.Fprintf(w, "%s: no periodic patterns were detected.\n", scope.name)
+			continue
+		}
+		for _, p := range scope.periods {
+			fmt.Fprintf(w, "%s: %s\n", scope.name, explainPeriod(p))
+		}
+	}
+}
+
+// explainPeriod описывает один период: длительность, уверенность и календарный цикл
+func explainPeriod(p timeseries.PeriodResult) string {
+	sentence := fmt.Sprintf("A ~%s cycle was detected with %s", p.PeriodLabel, describeConfidence(p.PValue))
+	if cycle, ok := matchNamedCycle(p.Period); ok {
+		return sentence + fmt.Sprintf(", consistent with a %s pattern.", cycle)
+	}
+	return sentence + ", not matching a calendar cycle."
+}
+
+// describeConfidence переводит p-значение в словесную оценку уверенности. Это
+// p-значение отдельной частоты (см. powerPValue), а не вероятность ложной тревоги
+// по всей сетке, поэтому в тексте оно так и называется.
+func describeConfidence(pValue float64) string {
+	switch {
+	case pValue < 0.001:
+		return "high confidence (p-value < 0.001)"
+	case pValue < 0.01:
+		return "moderate confidence (p-value < 0.01)"
+	case pValue < 0.05:
+		return "low confidence (p-value < 0.05)"
+	default:
+		return fmt.Sprintf("little confidence (p-value %.2g, possibly noise)", pValue)
+	}
+}
+
+// matchNamedCycle возвращает название календарного цикла, ближайшего к периоду
+// в пределах cycleTolerance
+func matchNamedCycle(hours float64) (string, bool) {
+	for _, cycle := range namedCycles {
+		if math.Abs(hours-cycle.hours) <= cycleTolerance*cycle.hours {
+			return cycle.name, true
+		}
+	}
+	return "", false
+}
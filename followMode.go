@@ -0,0 +1,273 @@
+package main
+
+import (
+	"AT/timeseries"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// followUpdate - строка вывода -follow: периоды allTime после очередного обновления
+type followUpdate struct {
+	Time         time.Time                 `json:"time"`
+	TotalRecords int                       `json:"totalRecords"`
+	AllTime      []timeseries.PeriodResult `json:"allTime"`
+}
+
+// checkFollowInput проверяет, что файл можно читать построчно с конца: CSV или .txt без сжатия
+func checkFollowInput(filename string) {
+	name := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		log.Fatal("-follow cannot read compressed input")
+	case filepath.Ext(name) == ".jsonl" || filepath.Ext(name) == ".ndjson":
+		log.Fatal("-follow supports only CSV and .txt input")
+	}
+}
+
+// followFile следит за дописываемым файлом tail, как tail -f, и каждые interval
+// выводит в stdout строку JSON (followUpdate) с периодами allTime, если появились
+// новые строки. Периодограмма обновляется через Accumulator только на вкладе новых
+// меток; timestamps - метки, загруженные до смещения, с которого читает tail, а
+// units - единицы их числовых столбцов (inputUnits), в которых разбираются новые строки.
+//
+// Сетка частот Accumulator рассчитана на удвоенную длительность данных и
+// перестраивается по всем меткам, когда данные ее перерастают; MaxPeriod на это
+// время ограничен длительностью данных / max(MinCycles, 2), как в AnalyzeTimestamps.
+// Если файл усечен, метки загружаются заново с его начала. Если он заменен новым
+// (ротация), остаток старого файла дочитывается, а новый читается с начала как
+// продолжение данных. Некорректные ячейки пропускаются с предупреждением. Остальные области анализа,
+// BusinessHours и SampleFraction в этом режиме не применяются.
+func followFile(tail *tailReader, timestamps []int64, units columnUnits, config timeseries.PeriodConfig, interval time.Duration) {
+	filename := tail.filename
+	log.Printf("Following %s every %s", filename, interval)
+
+	encoder := json.NewEncoder(os.Stdout)
+	var acc *timeseries.Accumulator
+	var gridSpan time.Duration
+	for range time.Tick(interval) {
+		lines, reset, err := tail.readLines()
+		if err != nil {
+			// Строки, прочитанные до ошибки (например, остаток старого файла
+			// при ротации), все равно учитываются
+			log.Printf("Warning: failed to read %s: %v", filename, err)
+		}
+		if reset {
+			log.Printf("%s was truncated; reloading from the start", filename)
+			timestamps, acc, units = nil, nil, nil
+		}
+
+		added := parseFollowLines(lines, &units)
+		if len(added) == 0 && !reset {
+			continue
+		}
+		timestamps = append(timestamps, added...)
+
+		span := timestampSpan(timestamps)
+		if acc == nil || span > gridSpan {
+			gridSpan = 2 * span
+			if gridSpan < 24*time.Hour {
+				gridSpan = 24 * time.Hour
+			}
+			if acc, err = newFollowAccumulator(config, span, gridSpan); err != nil {
+				log.Fatalf("Failed to build periodogram: %v", err)
+			}
+			acc.Add(timestamps...)
+		} else {
+			acc.Add(added...)
+		}
+
+		encoder.Encode(followUpdate{Time: time.Now(), TotalRecords: acc.Count(), AllTime: acc.Periods()})
+	}
+}
+
+// newFollowAccumulator создает Accumulator области allTime для данных длительности
+// span с сеткой частот на gridSpan
+func newFollowAccumulator(config timeseries.PeriodConfig, span, gridSpan time.Duration) (*timeseries.Accumulator, error) {
+	if r, ok := config.ScopePeriodRanges[timeseries.ScopeAllTime]; ok {
+		if r.Min > 0 {
+			config.MinPeriod = r.Min
+		}
+		if r.Max > 0 {
+			config.MaxPeriod = r.Max
+		}
+	}
+	if limit := span.Hours() / math.Max(config.MinCycles, 2); limit > config.MinPeriod && limit < config.MaxPeriod {
+		config.MaxPeriod = limit
+	}
+	return timeseries.NewAccumulator(config, gridSpan)
+}
+
+// timestampSpan возвращает длительность между первой и последней меткой
+func timestampSpan(timestamps []int64) time.Duration {
+	if len(timestamps) == 0 {
+		return 0
+	}
+	first, last := timestamps[0], timestamps[0]
+	for _, ts := range timestamps {
+		if ts < first {
+			first = ts
+		}
+		if ts > last {
+			last = ts
+		}
+	}
+	return time.Duration(last-first) * time.Millisecond
+}
+
+// parseFollowLines разбирает строки CSV или .txt: каждая непустая ячейка - метка.
+// units хранит единицы числовых меток столбцов между вызовами.
+func parseFollowLines(lines []string, units *columnUnits) []int64 {
+	var timestamps []int64
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		record, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil {
+			log.Printf("Warning: skipped malformed line %q: %v", line, err)
+			continue
+		}
+		for i, value := range record {
+			if value == "" {
+				continue
+			}
+			ts, err := parseTimestamp(value, units.at(i))
+			if err != nil {
+				log.Printf("Warning: skipped invalid timestamp %q", value)
+				continue
+			}
+			timestamps = append(timestamps, ts)
+		}
+	}
+	return timestamps
+}
+
+// tailReader читает строки, дописанные в файл с прошлого чтения. Незавершенная
+// последняя строка (без перевода строки) откладывается до следующего чтения.
+type tailReader struct {
+	filename string
+	file     *os.File
+	info     os.FileInfo
+	offset   int64
+	partial  string
+}
+
+// openTail открывает filename для слежения с конца его последней полной строки
+func openTail(filename string) (*tailReader, error) {
+	tail := &tailReader{filename: filename}
+	if err := tail.open(true); err != nil {
+		return nil, err
+	}
+	return tail, nil
+}
+
+// open открывает файл; при atEnd чтение начнется после последней полной строки,
+// а незавершенная строка будет прочитана целиком, когда ее допишут
+func (t *tailReader) open(atEnd bool) error {
+	file, err := os.Open(t.filename)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.file, t.info, t.offset, t.partial = file, info, 0, ""
+	if atEnd {
+		if t.offset, err = lineEnd(file, info.Size()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineEnd возвращает смещение сразу после последнего перевода строки в первых size
+// байтах file или 0, если перевода строки нет
+func lineEnd(file *os.File, size int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		n, err := file.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// readLines возвращает завершенные строки, дописанные с прошлого чтения. reset
+// сообщает, что файл был усечен и строки читаются с его начала. Если файл заменен
+// новым (ротация), сначала возвращается остаток старого файла, включая его
+// незавершенную последнюю строку, а затем строки нового с начала; reset при этом
+// не выставляется. Пока файл отсутствует (например, между переименованием и
+// созданием нового при ротации), строк нет и ошибки тоже нет.
+func (t *tailReader) readLines() (lines []string, reset bool, err error) {
+	info, err := os.Stat(t.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	switch {
+	case !os.SameFile(info, t.info):
+		// Старый файл больше не дописывается: его остаток читается через
+		// открытый дескриптор до переключения
+		if lines, err = t.read(); err != nil {
+			return nil, false, err
+		}
+		if t.partial != "" {
+			lines = append(lines, t.partial)
+			t.partial = ""
+		}
+		if err := t.open(false); err != nil {
+			return lines, false, err
+		}
+	case info.Size() < t.offset:
+		if err := t.open(false); err != nil {
+			return nil, false, err
+		}
+		reset = true
+	}
+
+	added, err := t.read()
+	return append(lines, added...), reset, err
+}
+
+// read возвращает завершенные строки текущего файла, дописанные с прошлого чтения
+func (t *tailReader) read() ([]string, error) {
+	data, err := io.ReadAll(io.NewSectionReader(t.file, t.offset, math.MaxInt64-t.offset))
+	if err != nil {
+		return nil, err
+	}
+	t.offset += int64(len(data))
+
+	text := t.partial + string(data)
+	end := strings.LastIndexByte(text, '\n')
+	if end < 0 {
+		t.partial = text
+		return nil, nil
+	}
+	t.partial = text[end+1:]
+	return strings.Split(text[:end], "\n"), nil
+}
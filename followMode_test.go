@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTailReaderKeepsRowsAroundLoadAndRotation(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "events.txt")
+	if err := os.WriteFile(name, []byte("1\n2\n3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Начальная загрузка читает только полные строки, незавершенная "3" достается tail
+	tail, err := openTail(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tail.file.Close()
+	defer delete(inputLimits, name)
+	inputLimits[name] = tail.offset
+	loaded, err := loadTimestampsFromLines(name)
+	if err != nil || !reflect.DeepEqual(loaded, []int64{1, 2}) {
+		t.Fatalf("initial load = %v, %v; want [1 2]", loaded, err)
+	}
+
+	appendFile(t, name, "0\n4\n5")
+	lines, reset, err := tail.readLines()
+	if err != nil || reset || !reflect.DeepEqual(lines, []string{"30", "4"}) {
+		t.Fatalf("readLines = %q, %v, %v; want [30 4]", lines, reset, err)
+	}
+
+	// Ротация: остаток старого файла, включая незавершенную "56", читается до нового
+	appendFile(t, name, "6")
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("7\n9\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines, reset, err = tail.readLines()
+	if err != nil || reset || !reflect.DeepEqual(lines, []string{"56", "7", "9"}) {
+		t.Fatalf("readLines after rotation = %q, %v, %v; want [56 7 9]", lines, reset, err)
+	}
+
+	// Усечение (файл стал короче прочитанного) перечитывает его с начала
+	if err := os.WriteFile(name, []byte("8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lines, reset, err = tail.readLines()
+	if err != nil || !reset || !reflect.DeepEqual(lines, []string{"8"}) {
+		t.Fatalf("readLines after truncation = %q, %v, %v; want [8] with reset", lines, reset, err)
+	}
+}
+
+func TestFollowKeepsLoadedUnits(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "events.txt")
+	if err := os.WriteFile(name, []byte("1687000000.5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(inputUnits, name)
+	if _, err := loadTimestampsFromLines(name); err != nil {
+		t.Fatal(err)
+	}
+
+	// Дробная метка при загрузке выбрала секунды: целая дописанная метка - тоже секунды
+	units := inputUnits[name]
+	if got := parseFollowLines([]string{"1687003600"}, &units); !reflect.DeepEqual(got, []int64{1687003600000}) {
+		t.Errorf("appended timestamps = %v, want [1687003600000]", got)
+	}
+}
+
+// appendFile дописывает text в конец файла name
+func appendFile(t *testing.T, name, text string) {
+	t.Helper()
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
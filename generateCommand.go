@@ -0,0 +1,97 @@
+package main
+
+import (
+	"AT/timeseries"
+	"encoding/csv"
+	"flag"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	subcommands["generate"] = runGenerate
+}
+
+// runGenerate записывает синтетические временные метки в CSV: AT generate [flags]
+func runGenerate(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	outputFile := flags.String("output", "", "Path to output CSV file (default: stdout)")
+	start := flags.String("start", "2023-01-01T00:00:00Z", "Start of the series (RFC3339)")
+	span := flags.Duration("span", 90*24*time.Hour, "Length of the series")
+	rate := flags.Float64("rate", 10, "Mean number of events per hour")
+	periods := flags.String("periods", "24h,168h", "Comma-separated injected periods (durations or hours)")
+	amplitudes := flags.String("amplitudes", "", "Comma-separated modulation depths (0..1) for each period (default: 1)")
+	noise := flags.Float64("noise", 0.2, "Fraction of unmodulated noise events (0..1)")
+	seed := flags.Int64("seed", 1, "Random seed")
+	flags.Parse(args)
+
+	spec := timeseries.SyntheticSpec{
+		Span:  *span,
+		Rate:  *rate,
+		Noise: *noise,
+		Seed:  *seed,
+	}
+
+	var err error
+	if spec.Start, err = time.Parse(time.RFC3339, *start); err != nil {
+		log.Fatalf("Invalid start: %v", err)
+	}
+	for _, value := range splitList(*periods) {
+		period, err := parsePeriodHours(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if period <= 0 || math.IsNaN(period) || math.IsInf(period, 0) {
+			log.Fatalf("Invalid period %q: must be positive", value)
+		}
+		spec.Periods = append(spec.Periods, period)
+	}
+	for _, value := range splitList(*amplitudes) {
+		amplitude, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			log.Fatalf("Invalid amplitude %q: %v", value, err)
+		}
+		spec.Amplitudes = append(spec.Amplitudes, amplitude)
+	}
+
+	timestamps := timeseries.GenerateSyntheticTimestamps(spec)
+
+	var out io.Writer = os.Stdout
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer := csv.NewWriter(out)
+	for _, ts := range timestamps {
+		if err := writer.Write([]string{strconv.FormatInt(ts, 10)}); err != nil {
+			log.Fatalf("Failed to write timestamps: %v", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Fatalf("Failed to write timestamps: %v", err)
+	}
+
+	log.Printf("Generated %d timestamps", len(timestamps))
+}
+
+// splitList разбирает список значений, разделенных запятыми, пропуская пустые
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,78 @@
+//go:build grpc
+
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/status"
+)
+
+// serverMetrics - метрики Prometheus gRPC-сервера. Nil-значение ничего не
+// учитывает, поэтому без -metrics-address накладных расходов нет.
+type serverMetrics struct {
+	requests  prometheus.Counter
+	errors    *prometheus.CounterVec
+	duration  prometheus.Histogram
+	inputSize prometheus.Histogram
+}
+
+// newServerMetrics регистрирует метрики и запускает HTTP-сервер с /metrics на
+// address; при пустом address возвращает nil
+func newServerMetrics(address string) *serverMetrics {
+	if address == "" {
+		return nil
+	}
+
+	m := &serverMetrics{
+		requests: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "at_analyze_requests_total",
+			Help: "Number of Analyze requests, including cached ones.",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "at_analyze_errors_total",
+			Help: "Number of failed Analyze requests by gRPC status code.",
+		}, []string{"code"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "at_analyze_duration_seconds",
+			Help:    "Time spent handling Analyze requests.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms - 4.4min
+		}),
+		inputSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "at_analyze_input_timestamps",
+			Help:    "Number of timestamps per Analyze request.",
+			Buckets: prometheus.ExponentialBuckets(10, 10, 7), // 10 - 10^7
+		}),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.requests, m.errors, m.duration, m.inputSize)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		log.Printf("Metrics available at http://%s/metrics", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			log.Fatalf("Metrics server failed: %v", err)
+		}
+	}()
+
+	return m
+}
+
+// observe учитывает запрос с timestamps метками, обработанный за elapsed
+func (m *serverMetrics) observe(timestamps int, elapsed time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.requests.Inc()
+	m.duration.Observe(elapsed.Seconds())
+	m.inputSize.Observe(float64(timestamps))
+	if err != nil {
+		m.errors.WithLabelValues(status.Code(err).String()).Inc()
+	}
+}
@@ -0,0 +1,299 @@
+//go:build grpc
+
+// Сборка с gRPC-сервером: go generate -tags grpc && go build -tags grpc
+//
+//go:generate protoc --go_out=. --go_opt=module=AT --go-grpc_out=. --go-grpc_opt=module=AT proto/timeseries.proto
+
+package main
+
+import (
+	"AT/timeseries"
+	"AT/timeseriespb"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"flag"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func init() {
+	subcommands["grpc"] = runGRPCServer
+}
+
+// runGRPCServer запускает gRPC-сервер анализа: AT grpc [-cache-size N] [-metrics-address addr] [address]
+func runGRPCServer(args []string) {
+	flags := flag.NewFlagSet("grpc", flag.ExitOnError)
+	cacheSize := flags.Int("cache-size", 0, "Number of analysis results kept in an in-memory LRU cache keyed by request (0 = disabled)")
+	maxTimestamps := flags.Int("max-timestamps", 1000000, "Reject requests with more timestamps than this (0 = unlimited)")
+	metricsAddress := flags.String("metrics-address", "", "Serve Prometheus metrics at http://<address>/metrics, e.g. :9091 (empty = disabled)")
+	flags.Parse(args)
+	if *maxTimestamps < 0 {
+		log.Fatal("max-timestamps must not be negative")
+	}
+
+	address := ":9090"
+	if flags.NArg() > 0 {
+		address = flags.Arg(0)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", address, err)
+	}
+
+	// Сообщение должно вмещать запрос с предельным количеством меток
+	// (до 10 байт на метку в varint) вместе с конфигурацией. Без ограничения
+	// количества меток снимается и ограничение gRPC по умолчанию в 4 МБ.
+	maxMessageSize := math.MaxInt32
+	if *maxTimestamps > 0 && *maxTimestamps < (math.MaxInt32-64*1024)/10 {
+		maxMessageSize = *maxTimestamps*10 + 64*1024
+	}
+	server := grpc.NewServer(grpc.MaxRecvMsgSize(maxMessageSize))
+	timeseriespb.RegisterAnalyzerServer(server, &analyzerServer{
+		cache:         newResultCache(*cacheSize),
+		maxTimestamps: *maxTimestamps,
+		metrics:       newServerMetrics(*metricsAddress),
+	})
+
+	log.Printf("gRPC server listening on %s", address)
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("gRPC server failed: %v", err)
+	}
+}
+
+// analyzerServer реализует сервис Analyzer поверх timeseries.AnalyzeTimestamps
+type analyzerServer struct {
+	timeseriespb.UnimplementedAnalyzerServer
+
+	cache *resultCache // nil - кэширование отключено
+
+	// maxTimestamps ограничивает размер одного запроса: память анализа растет
+	// линейно с количеством меток (копии в time.Time, веса, сортировки областей),
+	// а массивы частот и агрегаций ограничены serverMaxOperations и MaxAggregationBuckets
+	maxTimestamps int
+
+	metrics *serverMetrics // nil - метрики отключены
+}
+
+func (s *analyzerServer) Analyze(ctx context.Context, req *timeseriespb.AnalyzeRequest) (response *timeseriespb.AnalysisResult, err error) {
+	started := time.Now()
+	defer func() {
+		s.metrics.observe(len(req.GetTimestamps()), time.Since(started), err)
+	}()
+
+	if n := len(req.GetTimestamps()); s.maxTimestamps > 0 && n > s.maxTimestamps {
+		return nil, status.Errorf(codes.ResourceExhausted, "request has %d timestamps, limit is %d", n, s.maxTimestamps)
+	}
+
+	var key [sha256.Size]byte
+	if s.cache != nil {
+		// Детерминированная сериализация: одинаковые метки и конфигурация дают одинаковый ключ
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		key = sha256.Sum256(data)
+		if cached, ok := s.cache.get(key); ok {
+			return cached, nil
+		}
+	}
+
+	config := configFromProto(req.GetConfig())
+
+	result, err := timeseries.AnalyzeTimestamps(req.GetTimestamps(), config)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	response = analysisResultToProto(result)
+	if s.cache != nil {
+		s.cache.put(key, response)
+	}
+	return response, nil
+}
+
+// resultCache - LRU-кэш результатов анализа, ключ - SHA-256 сериализованного запроса.
+// Закэшированные сообщения возвращаются всем клиентам и не должны изменяться.
+type resultCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Элементы *cacheEntry, от недавно использованных к давним
+	entries map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key    [sha256.Size]byte
+	result *timeseriespb.AnalysisResult
+}
+
+// newResultCache создает кэш на size результатов; при size <= 0 возвращает nil
+func newResultCache(size int) *resultCache {
+	if size <= 0 {
+		return nil
+	}
+	return &resultCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+	}
+}
+
+// get возвращает закэшированный результат и отмечает его как недавно использованный
+func (c *resultCache) get(key [sha256.Size]byte) (*timeseriespb.AnalysisResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).result, true
+}
+
+// put сохраняет результат, вытесняя давно не использованный при переполнении
+func (c *resultCache) put(key [sha256.Size]byte, result *timeseriespb.AnalysisResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).result = result
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// serverMaxOperations ограничивает объем вычислений одного запроса, поскольку
+// запросы к серверу недоверенные
+const serverMaxOperations = 5e10
+
+// configFromProto накладывает ненулевые поля запроса на конфигурацию по умолчанию
+func configFromProto(c *timeseriespb.PeriodConfig) timeseries.PeriodConfig {
+	config := timeseries.DefaultPeriodConfig()
+	config.MaxOperations = serverMaxOperations
+	if c == nil {
+		return config
+	}
+
+	if c.GetMinPeriod() > 0 {
+		config.MinPeriod = c.GetMinPeriod()
+	}
+	if c.GetMaxPeriod() > 0 {
+		config.MaxPeriod = c.GetMaxPeriod()
+	}
+	if c.GetNumPeriods() > 0 {
+		config.NumPeriods = int(c.GetNumPeriods())
+	}
+	if c.GetSamplesPerPeak() > 0 {
+		config.SamplesPerPeak = int(c.GetSamplesPerPeak())
+	}
+	config.ByWeekday = c.GetByWeekday()
+	config.SkipContinuous = c.GetSkipContinuous()
+	config.MinProminence = c.GetMinProminence()
+	config.ByMonth = c.GetByMonth()
+	if window := c.GetRollingWindow().AsDuration(); window > 0 {
+		config.RollingWindow = window
+		config.RollingStep = c.GetRollingStep().AsDuration()
+		if config.RollingStep == 0 {
+			config.RollingStep = window
+		}
+	}
+
+	return config
+}
+
+// analysisResultToProto конвертирует результат анализа в proto-сообщение
+func analysisResultToProto(r *timeseries.AnalysisResult) *timeseriespb.AnalysisResult {
+	out := &timeseriespb.AnalysisResult{
+		TotalRecords: int64(r.TotalRecords),
+		StartDate:    timestamppb.New(r.StartDate),
+		EndDate:      timestamppb.New(r.EndDate),
+		Periods:      periodResultsToProto(r.Periods),
+		Continuous: &timeseriespb.ContinuousResult{
+			AllData:           periodResultsToProto(r.Continuous.AllData),
+			LongestContinuous: periodResultsToProto(r.Continuous.LongestContinuous),
+			Start:             timestamppb.New(r.Continuous.Start),
+			End:               timestamppb.New(r.Continuous.End),
+			RecordCount:       int64(r.Continuous.RecordCount),
+		},
+		Warnings:      r.Warnings,
+		SchemaVersion: int32(r.SchemaVersion),
+	}
+
+	for _, d := range r.Days {
+		out.Days = append(out.Days, &timeseriespb.DayRecord{Date: timestamppb.New(d.Date), Count: int64(d.Count), Rate: d.Rate})
+	}
+	for _, w := range r.Weeks {
+		out.Weeks = append(out.Weeks, &timeseriespb.WeekRecord{Week: timestamppb.New(w.Week), Count: int64(w.Count), IsoWeek: w.ISOWeek, Rate: w.Rate})
+	}
+	for _, m := range r.Months {
+		out.Months = append(out.Months, &timeseriespb.MonthRecord{Month: timestamppb.New(m.Month), Count: int64(m.Count), Rate: m.Rate})
+	}
+	for _, w := range r.Rolling {
+		out.Rolling = append(out.Rolling, &timeseriespb.RollingResult{
+			Start:       timestamppb.New(w.Start),
+			End:         timestamppb.New(w.End),
+			RecordCount: int64(w.RecordCount),
+			Periods:     periodsToProto(w.Periods),
+		})
+	}
+
+	return out
+}
+
+// periodResultsToProto конвертирует результаты по областям в proto-сообщение
+func periodResultsToProto(pr timeseries.PeriodResults) *timeseriespb.PeriodResults {
+	out := &timeseriespb.PeriodResults{
+		Daily:     periodsToProto(pr.Daily),
+		Weekly:    periodsToProto(pr.Weekly),
+		AllTime:   periodsToProto(pr.AllTime),
+		Quarterly: make(map[string]*timeseriespb.PeriodList, len(pr.Quarterly)),
+	}
+
+	for quarter, periods := range pr.Quarterly {
+		out.Quarterly[quarter] = &timeseriespb.PeriodList{Periods: periodsToProto(periods)}
+	}
+	if len(pr.Weekdays) > 0 {
+		out.Weekdays = make(map[int32]*timeseriespb.PeriodList, len(pr.Weekdays))
+		for weekday, periods := range pr.Weekdays {
+			out.Weekdays[int32(weekday)] = &timeseriespb.PeriodList{Periods: periodsToProto(periods)}
+		}
+	}
+	if len(pr.Monthly) > 0 {
+		out.Monthly = make(map[string]*timeseriespb.PeriodList, len(pr.Monthly))
+		for month, periods := range pr.Monthly {
+			out.Monthly[month] = &timeseriespb.PeriodList{Periods: periodsToProto(periods)}
+		}
+	}
+
+	return out
+}
+
+// periodsToProto конвертирует список периодов в proto-сообщения
+func periodsToProto(periods []timeseries.PeriodResult) []*timeseriespb.PeriodResult {
+	out := make([]*timeseriespb.PeriodResult, len(periods))
+	for i, p := range periods {
+		out[i] = &timeseriespb.PeriodResult{
+			Period:       p.Period,
+			Power:        p.Power,
+			Significance: p.Significance,
+			PeriodLabel:  p.PeriodLabel,
+			PValue:       p.PValue,
+		}
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package timeseries
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Accumulator поддерживает периодограмму allTime для непрерывно пополняемого потока
+// событий. Мощность на фиксированной частоте зависит от событий только через суммы
+// Σcos(ωt) и Σsin(ωt) (а для ModelFloatingMean еще через N и границы окна), поэтому
+// Add добавляет лишь вклад новых событий, не пересчитывая периодограмму целиком.
+//
+// Сетка частот фиксируется при создании по ожидаемой длительности наблюдения span
+// и не меняется при росте данных. Если фактическая длительность заметно превысит
+// span, разрешение сетки станет недостаточным, и Accumulator стоит пересоздать.
+//
+// Численная устойчивость. Время отсчитывается в часах от Epoch (или от первого
+// добавленного события, если Epoch не задан). Погрешность фазы ωt растет
+// пропорционально |t - Epoch|, поэтому для многолетних потоков Epoch лучше
+// выбирать близко к данным. Ошибка округления сумм накапливается примерно как
+// √n·ε и для реалистичных n остается много меньше статистического шума
+// (порядка √n), но при очень долгой работе суммы рекомендуется периодически
+// пересчитывать с нуля через Reset и повторный Add.
+//
+// Accumulator не безопасен для конкурентного использования.
+type Accumulator struct {
+	detector *periodDetector
+	freqs    []float64
+	sumCos   []float64
+	sumSin   []float64
+	count    int
+	t0, t1   float64
+	epoch    time.Time
+}
+
+// NewAccumulator создает Accumulator с сеткой частот для диапазона периодов config
+// и ожидаемой длительности наблюдения span
+func NewAccumulator(config PeriodConfig, span time.Duration) (*Accumulator, error) {
+	if config.MinPeriod <= 0 || config.MaxPeriod <= 0 {
+		return nil, errors.New("minPeriod and maxPeriod must be positive")
+	}
+	if config.MinPeriod >= config.MaxPeriod {
+		return nil, errors.New("minPeriod must be less than maxPeriod")
+	}
+	if config.NumPeriods <= 0 {
+		return nil, errors.New("numPeriods must be at least 1")
+	}
+	if config.SamplesPerPeak <= 0 {
+		return nil, errors.New("samplesPerPeak must be at least 1")
+	}
+	if span <= 0 {
+		return nil, errors.New("span must be positive")
+	}
+	switch config.Model {
+	case "", ModelStandard, ModelFloatingMean:
+	default:
+		return nil, fmt.Errorf("unknown model %q", config.Model)
+	}
+	if config.MinCycles < 0 {
+		return nil, errors.New("minCycles must not be negative")
+	}
+	for _, period := range config.ExcludePeriods {
+		if period <= 0 {
+			return nil, errors.New("excludePeriods must be positive")
+		}
+	}
+	if r := config.ScopePeriodRanges[ScopeAllTime]; r.Min < 0 || r.Max < 0 || (r.Min > 0 && r.Max > 0 && r.Min >= r.Max) {
+		return nil, fmt.Errorf("scopePeriodRanges[%q] must satisfy 0 < min < max", ScopeAllTime)
+	}
+	if config.MinProminence < 0 || config.MinProminence >= 1 {
+		return nil, errors.New("minProminence must be in range [0, 1)")
+	}
+	if config.PeakNeighborhood < 0 || config.EdgeExclusionBins < 0 {
+		return nil, errors.New("peakNeighborhood and edgeExclusionBins must not be negative")
+	}
+	if config.CumulativeSignificance < 0 || config.CumulativeSignificance > 1 {
+		return nil, errors.New("cumulativeSignificance must be between 0 and 1")
+	}
+
+	detector := newPeriodDetector(config)
+	freqs, _ := detector.frequencyGrid(span.Hours(), 1/config.MaxPeriod, 1/config.MinPeriod, &spectrumBuffers{})
+
+	return &Accumulator{
+		detector: detector,
+		freqs:    freqs,
+		sumCos:   make([]float64, len(freqs)),
+		sumSin:   make([]float64, len(freqs)),
+		epoch:    config.Epoch,
+	}, nil
+}
+
+// Add добавляет вклад временных меток (Unix, миллисекунды). Порядок меток не важен.
+func (a *Accumulator) Add(timestamps ...int64) {
+	for _, ts := range timestamps {
+		tm := time.Unix(ts/1000, (ts%1000)*int64(time.Millisecond))
+		if a.epoch.IsZero() {
+			a.epoch = tm
+		}
+		t := tm.Sub(a.epoch).Hours()
+
+		if a.count == 0 {
+			a.t0, a.t1 = t, t
+		}
+		a.t0 = math.Min(a.t0, t)
+		a.t1 = math.Max(a.t1, t)
+		a.count++
+
+		for i, f := range a.freqs {
+			omega := 2 * math.Pi * f
+			a.sumCos[i] += math.Cos(omega * t)
+			a.sumSin[i] += math.Sin(omega * t)
+		}
+	}
+}
+
+// Reset удаляет накопленные суммы, сохраняя сетку частот и начало отсчета
+func (a *Accumulator) Reset() {
+	for i := range a.freqs {
+		a.sumCos[i] = 0
+		a.sumSin[i] = 0
+	}
+	a.count = 0
+}
+
+// Count возвращает количество добавленных событий
+func (a *Accumulator) Count() int {
+	return a.count
+}
+
+// Periodogram возвращает текущую периодограмму
+func (a *Accumulator) Periodogram() Periodogram {
+	powers := make([]float64, len(a.freqs))
+	if a.count < 4 || a.t1 <= a.t0 {
+		return Periodogram{Frequencies: append([]float64(nil), a.freqs...), Powers: powers}
+	}
+
+	N := float64(a.count)
+	for i, f := range a.freqs {
+		if a.detector.config.Model == ModelFloatingMean {
+			powers[i] = floatingMeanPower(a.sumCos[i], a.sumSin[i], N, N, 2*math.Pi*f, a.t0, a.t1)
+		} else {
+			powers[i] = (a.sumCos[i]*a.sumCos[i] + a.sumSin[i]*a.sumSin[i]) / N
+		}
+	}
+
+	return Periodogram{Frequencies: append([]float64(nil), a.freqs...), Powers: powers}
+}
+
+// Periods возвращает наиболее значимые периоды по текущим суммам. Как и в области
+// allTime AnalyzeTimestamps, периоды ищутся в диапазоне ScopePeriodRanges[allTime],
+// ограниченном длительностью данных / max(MinCycles, 2) (поэтому периоды, не
+// укладывающиеся MinCycles раз в данные, не возвращаются), с ExcludePeriods,
+// EdgeExclusionBins, MinProminence и CumulativeSignificance.
+//
+// Отличия от AnalyzeTimestamps: сетка частот фиксирована при создании (см.
+// NewAccumulator), события не группируются по BinWidth и не имеют весов, а
+// RefinePeaks, WindowContamination, Describe, IncludeRawComponents и Fundamental,
+// которым нужны сами метки, не применяются.
+func (a *Accumulator) Periods() []PeriodResult {
+	if a.count < 4 || a.t1 <= a.t0 {
+		return nil
+	}
+	spectrum := a.Periodogram()
+
+	// Часть сетки в диапазоне области allTime для текущей длительности данных
+	start := a.epoch.Add(time.Duration(a.t0 * float64(time.Hour)))
+	end := a.epoch.Add(time.Duration(a.t1 * float64(time.Hour)))
+	minPeriod, maxPeriod := a.detector.scopePeriodRange(ScopeAllTime, "", []time.Time{start, end})
+	lo := sort.SearchFloat64s(spectrum.Frequencies, 1/maxPeriod)
+	hi := sort.SearchFloat64s(spectrum.Frequencies, math.Nextafter(1/minPeriod, math.Inf(1)))
+	if lo >= hi {
+		return nil
+	}
+	return a.detector.findSignificantPeaks(spectrum.Frequencies[lo:hi], spectrum.Powers[lo:hi], a.detector.numPeriods(ScopeAllTime, ScopeAllTime))
+}
@@ -0,0 +1,52 @@
+package timeseries
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAccumulatorMatchesAllTime(t *testing.T) {
+	// Двадцать дней растущей интенсивности с суточным циклом: тренд дает мощность
+	// на периодах длиннее данных, которые allTime отбрасывает
+	var timestamps []int64
+	for h := 0; h < 20*24; h++ {
+		n := int(math.Round(2 + 4*float64(h)/480 + 2*math.Sin(2*math.Pi*float64(h)/24)))
+		for k := 0; k < n; k++ {
+			timestamps = append(timestamps, testStart.Add(time.Duration(h)*time.Hour+time.Duration(k)*time.Minute).UnixMilli())
+		}
+	}
+	span := time.Duration(timestamps[len(timestamps)-1]-timestamps[0]) * time.Millisecond
+
+	config := testConfig()
+	config.MaxPeriod = 1000
+	result, err := AnalyzeTimestamps(timestamps, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc, err := NewAccumulator(config, 2*span)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acc.Add(timestamps...)
+	periods := acc.Periods()
+
+	want := result.Periods.AllTime
+	if len(periods) == 0 || len(want) == 0 {
+		t.Fatalf("accumulator periods %+v, allTime %+v", periods, want)
+	}
+	if math.Abs(periods[0].Period-want[0].Period) > 0.5 {
+		t.Errorf("accumulator top period = %g hours, allTime = %g", periods[0].Period, want[0].Period)
+	}
+	limit := result.EffectivePeriodRanges[ScopeAllTime].Max
+	for _, p := range periods {
+		if p.Period > limit*1.001 {
+			t.Errorf("accumulator period %g hours above the allTime limit %g", p.Period, limit)
+		}
+	}
+
+	config.Model = "unknown"
+	if _, err := NewAccumulator(config, span); err == nil {
+		t.Error("expected an error for an unknown model")
+	}
+}
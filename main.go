@@ -8,86 +8,628 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// subcommands содержит дополнительные команды, вызываемые как "AT <command> [args]"
+var subcommands = map[string]func(args []string){}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			run(os.Args[2:])
+			return
+		}
+	}
+
 	// Конфигурация флагов командной строки
-	inputFile := flag.String("input", "", "Path to input CSV file with timestamps")
-	outputFile := flag.String("output", "", "Path to output JSON file (default: stdout)")
-	minPeriod := flag.Float64("min-period", 0.1, "Minimum period in hours")
-	maxPeriod := flag.Float64("max-period", 8760, "Maximum period in hours")
+	inputFile := flag.String("input", "", "Path to input file with timestamps (.csv, .txt, .jsonl; optionally .gz)")
+	var outputs outputsFlag
+	flag.Var(&outputs, "output", "Output file, repeatable; path or format:path with format json, csv (periods), spectrum or influx (day/week/month counts) (default: JSON to stdout)")
+	compareFile := flag.String("compare", "", "Path to second timestamps file; output the periodicity diff against -input")
+	includeSamples := flag.Bool("include-scope-samples", false, "Include timestamps that entered the daily/weekly windows")
+	spectrumScopes := flag.String("spectrum-scopes", "", "Comma-separated scopes whose full periodogram is included (e.g. allTime,daily)")
+	weekStart := flag.String("week-start", "monday", "First day of the week for weekly aggregation (e.g. monday, sunday)")
+	periodTolerance := flag.Float64("period-tolerance", timeseries.DefaultPeriodTolerance, "Relative tolerance for matching periods (0.05 = 5%)")
+	jitter := flag.Duration("jitter", 0, "Deterministic jitter width for duplicate timestamps (e.g. 1ms)")
+	anchorToNow := flag.Bool("anchor-now", false, "Anchor daily/weekly windows to the current time instead of the last event")
+	adaptive := flag.Bool("adaptive", false, "Use a multi-resolution periodogram with logarithmic frequency bands")
+	seed := flag.Int64("seed", 0, "Random seed; identical input and seed produce identical output")
+	model := flag.String("model", string(timeseries.ModelStandard), "Periodogram power model: standard or floating-mean")
+	groupColumn := flag.Int("group-column", 0, "1-based CSV column with a category; analyze each category separately")
+	minPeriod := periodHoursFlag(0.1)
+	maxPeriod := periodHoursFlag(8760)
+	flag.Var(&minPeriod, "min-period", "Minimum period as duration (e.g. 6m, 24h) or number of hours")
+	flag.Var(&maxPeriod, "max-period", "Maximum period as duration (e.g. 8760h) or number of hours")
+	referencePeriod := periodHoursFlag(0)
+	flag.Var(&referencePeriod, "reference-period", "Reference period (e.g. 24h); adds periodRatio = period / reference to each result")
 	numPeriods := flag.Int("num-periods", 5, "Number of periods to return")
 	samplesPerPeak := flag.Int("samples-per-peak", 5, "Samples per peak for periodogram")
+	byWeekday := flag.Bool("weekdays", false, "Additionally detect periods separately for each weekday")
+	skipContinuous := flag.Bool("skip-continuous", false, "Skip continuous-period analysis")
+	skipAggregation := flag.Bool("skip-aggregation", false, "Skip day/week/month aggregation and only run spectral analysis")
+	minProminence := flag.Float64("min-prominence", 0, "Minimum peak prominence over its neighbors as a fraction of the maximum power")
+	jsonField := flag.String("json-field", "ts", "Timestamp field in .jsonl/.ndjson input; dotted path for nested objects (e.g. event.timestamp)")
+	maxBuckets := flag.Int("max-aggregation-buckets", 10000, "Maximum length of day/month series; longer ranges list only non-empty buckets (0 = unlimited)")
+	timezone := flag.String("timezone", "", "IANA time zone for calendar days, weeks and business hours (default: local) and for timestamps without offset (default: UTC)")
+	businessHours := flag.String("business-hours", "", "Analyze only events within business hours, e.g. 9-18 (end hour exclusive)")
+	businessDays := flag.String("business-days", "mon,tue,wed,thu,fri", "Comma-separated active weekdays for -business-hours")
+	deadline := flag.Duration("deadline", 0, "Time limit for spectral analysis; unfinished scopes are skipped with a warning (0 = none)")
+	scopeNumPeriods := flag.String("scope-num-periods", "", "Per-scope num-periods overrides, e.g. daily=3,allTime=10")
+	valueColumn := flag.Int("value-column", 0, "1-based CSV column with event values weighting the periodogram; timestamps are read from the first other column")
+	sigmaColumn := flag.Int("sigma-column", 0, "1-based CSV column with measurement errors of -value-column; values are then analyzed as measurements weighted by 1/sigma^2")
+	maxOperations := flag.Int64("max-operations", 0, "Refuse analyses estimated to need more sin/cos evaluations than this (0 = unlimited)")
+	peakNeighborhood := flag.Int("peak-neighborhood", 1, "Half-width in periodogram bins within which a peak must be the maximum")
+	parallelism := flag.Int("parallelism", 1, "Number of analysis scopes processed concurrently")
+	cumulative := flag.Bool("cumulative", false, "Include cumulativeDays, the running total of events per day")
+	excludePeriods := flag.String("exclude-periods", "", "Comma-separated known artifact periods to mask out (durations or hours, e.g. 24h)")
+	minCycles := flag.Float64("min-cycles", 2, "Drop periods that fit fewer than this many times into the scope's data span (0 = keep all)")
+	weeklyWindow := flag.Duration("weekly-window", 4*7*24*time.Hour, "Length of the weekly scope window ending at the last timestamp")
+	explain := flag.Bool("explain", false, "Print a plain-language description of each detected period to stderr")
+	sqliteFile := flag.String("sqlite", "", "Path to SQLite database to read timestamps from instead of -input (requires -query; build with -tags sqlite)")
+	query := flag.String("query", "", "SQL query for -sqlite; the first column of each row is a timestamp")
+	rollingWindow := flag.Duration("rolling-window", 0, "Analyze rolling windows of this length to track period drift (0 = disabled)")
+	rollingStep := flag.Duration("rolling-step", 0, "Shift between rolling windows; smaller than -rolling-window for overlap (default: window length)")
+	maxGap := flag.Duration("max-gap", 48*time.Hour, "Largest gap between days with events within one continuous segment")
+	minSegmentDays := flag.Int("min-segment-days", 0, "Minimum days with events for a segment to be listed in allContinuousSegments")
+	spectrumPreviewBins := flag.Int("spectrum-preview-bins", 0, "Downsample included spectra to this many max-pooled bins (0 = full spectra)")
+	assumeSorted := flag.Bool("assume-sorted", false, "Skip sorting timestamps that are already in time order; unsorted input is an error")
+	scopePeriodRanges := flag.String("scope-period-ranges", "", "Per-scope period ranges scope=min:max; an empty bound uses -min-period/-max-period (default: daily=1h:72h,weekly=12h:336h; a default bound applies only while -min-period/-max-period keeps its default)")
+	binWidth := flag.Duration("bin-width", 0, "Group events into bins of this width before the periodogram (0 = no binning)")
+	includeBinned := flag.Bool("include-binned-series", false, "Include the per-scope binned count series used for the periodogram (with -bin-width)")
+	includeLongest := flag.Bool("include-longest-records", false, "Include timestamps of the longest continuous period in continuous.longestContinuousRecords")
+	noiseModel := flag.String("noise-model", string(timeseries.NoiseGaussian), "Noise model of binned counts with -bin-width: gaussian or poisson")
+	cumulativeSignificance := flag.Float64("cumulative-significance", 0, "Report the fewest top periods whose significance sums to this fraction of total power, instead of -num-periods (0 = off)")
+	refinePeaks := flag.Bool("refine-peaks", false, "Refine each reported peak between periodogram bins with extra power evaluations")
+	sampleFraction := flag.Float64("sample-fraction", 0, "Analyze a seeded random sample of this fraction of timestamps for a fast approximate result (0 = all)")
+	byMonth := flag.Bool("months", false, "Additionally detect periods separately for each calendar month")
+	monthKeys := flag.String("month-keys", string(timeseries.MonthKeyISO), "Month keys in periods.monthly: iso (2023-06) or named (June 2023)")
+	failOnNoPeriods := flag.Bool("fail-on-no-periods", false, "Exit with a non-zero status after writing output if no allTime periods were found")
+	fundamental := flag.Bool("fundamental", false, "Report the allTime period best supported by its harmonics as fundamental")
+	describe := flag.Bool("describe", false, "Add schedule-style descriptions such as \"daily ~09:00\" to daily and weekly periods")
+	minQuarterRecords := flag.Int("min-quarter-records", 50, "Skip quarterly analysis of quarters with fewer events than this (0 = analyze all)")
+	smoothingWindow := flag.Int("smoothing-window", 0, "Add smoothedCount, a centered moving average over this many days, to the daily series (0 = off)")
+	edgeExclusionBins := flag.Int("edge-exclusion-bins", 0, "Ignore peaks within this many periodogram bins of either end of the frequency grid")
+	includeRaw := flag.Bool("include-raw-components", false, "Attach raw periodogram sums (sumCos, sumSin, n, weights) to each period")
+	skipBadRows := flag.Bool("skip-bad-rows", false, "Skip malformed CSV cells (rows with -value-column) instead of failing, and report skip counts per column")
+	follow := flag.Bool("follow", false, "After the initial analysis, watch the input file for appended rows and print updated allTime periods as JSON lines")
+	followInterval := flag.Duration("follow-interval", 10*time.Second, "Polling interval for -follow")
+	timestampUnit := flag.String("timestamp-unit", "auto", "Unit of numeric timestamps: ms, s or auto (decided once per column by its first number: integer = ms, fractional = s)")
+	configFile := flag.String("config", "", "Path to JSON file with PeriodConfig; explicitly set flags override its values")
 	flag.Parse()
 
 	// Валидация параметров
-	if *inputFile == "" {
-		log.Fatal("Input file is required. Use -input flag to specify CSV file")
+	if *sqliteFile != "" {
+		if *query == "" {
+			log.Fatal("-sqlite requires -query, e.g. -query \"SELECT ts FROM events\"")
+		}
+		if *groupColumn > 0 || *valueColumn > 0 {
+			log.Fatal("-sqlite cannot be combined with -group-column or -value-column")
+		}
+	} else if *inputFile == "" {
+		log.Fatal("Input file is required. Use -input flag to specify timestamps file")
 	}
-	if *minPeriod <= 0 || *maxPeriod <= 0 {
-		log.Fatal("Periods must be positive values")
+	weekStartDay, err := parseWeekday(*weekStart)
+	if err != nil {
+		log.Fatal(err)
 	}
-	if *minPeriod >= *maxPeriod {
-		log.Fatal("min-period must be less than max-period")
+	var location *time.Location
+	if *timezone != "" {
+		if location, err = time.LoadLocation(*timezone); err != nil {
+			log.Fatalf("Invalid timezone: %v", err)
+		}
 	}
-	if *numPeriods <= 0 {
-		log.Fatal("num-periods must be at least 1")
+	if defaultTimestampUnit, err = parseTimestampUnit(*timestampUnit); err != nil {
+		log.Fatal(err)
 	}
-
-	// Загрузка временных меток из CSV
-	timestamps, err := loadTimestampsFromCSV(*inputFile)
+	scopeLimits, err := parseScopeNumPeriods(*scopeNumPeriods)
 	if err != nil {
-		log.Fatalf("Failed to load timestamps: %v", err)
+		log.Fatal(err)
+	}
+	scopeRanges, err := parseScopePeriodRanges(*scopePeriodRanges)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var excluded []float64
+	for _, value := range splitList(*excludePeriods) {
+		period, err := parsePeriodHours(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		excluded = append(excluded, period)
+	}
+	var hours *timeseries.BusinessHours
+	if *businessHours != "" {
+		if hours, err = parseBusinessHours(*businessHours, *businessDays); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *groupColumn < 0 {
+		log.Fatal("group-column must be a positive column number")
+	}
+	if *groupColumn > 0 && *compareFile != "" {
+		log.Fatal("-compare cannot be combined with -group-column")
+	}
+	if *valueColumn < 0 {
+		log.Fatal("value-column must be a positive column number")
+	}
+	if *valueColumn > 0 && (*groupColumn > 0 || *compareFile != "") {
+		log.Fatal("-value-column cannot be combined with -group-column or -compare")
+	}
+	if *sigmaColumn < 0 {
+		log.Fatal("sigma-column must be a positive column number")
+	}
+	if *sigmaColumn > 0 && (*valueColumn == 0 || *sigmaColumn == *valueColumn) {
+		log.Fatal("-sigma-column requires -value-column and must differ from it")
+	}
+	if *follow {
+		if *sqliteFile != "" || *groupColumn > 0 || *valueColumn > 0 || *compareFile != "" {
+			log.Fatal("-follow cannot be combined with -sqlite, -group-column, -value-column or -compare")
+		}
+		if *followInterval <= 0 {
+			log.Fatal("follow-interval must be positive")
+		}
+		checkFollowInput(*inputFile)
 	}
-	log.Printf("Loaded %d timestamps from %s", len(timestamps), *inputFile)
 
 	// Конфигурация анализа
 	config := timeseries.PeriodConfig{
-		MinPeriod:      *minPeriod,
-		MaxPeriod:      *maxPeriod,
+		MinPeriod:      float64(minPeriod),
+		MaxPeriod:      float64(maxPeriod),
 		NumPeriods:     *numPeriods,
 		SamplesPerPeak: *samplesPerPeak,
+		ByWeekday:      *byWeekday,
+		SkipContinuous: *skipContinuous,
+		MinProminence:  *minProminence,
+		Model:          timeseries.PowerModel(*model),
+
+		IncludeScopeSamples: *includeSamples,
+		Seed:                *seed,
+		WeekStart:           &weekStartDay,
+		SpectrumScopes:      splitList(*spectrumScopes),
+		Jitter:              *jitter,
+		PeriodTolerance:     *periodTolerance,
+		SkipAggregation:     *skipAggregation,
+		AnchorToNow:         *anchorToNow,
+		Adaptive:            *adaptive,
+
+		MaxAggregationBuckets: *maxBuckets,
+		Location:              location,
+		BusinessHours:         hours,
+		Deadline:              *deadline,
+		ScopeNumPeriods:       scopeLimits,
+		MaxOperations:         *maxOperations,
+		ReferencePeriod:       float64(referencePeriod),
+		PeakNeighborhood:      *peakNeighborhood,
+		Parallelism:           *parallelism,
+		Cumulative:            *cumulative,
+		ExcludePeriods:        excluded,
+		MinCycles:             *minCycles,
+		WeeklyWindow:          *weeklyWindow,
+		RollingWindow:         *rollingWindow,
+		RollingStep:           *rollingStep,
+		MaxGap:                *maxGap,
+		MinSegmentDays:        *minSegmentDays,
+		SpectrumPreviewBins:   *spectrumPreviewBins,
+		AssumeSorted:          *assumeSorted,
+		ScopePeriodRanges:     scopeRanges,
+		BinWidth:              *binWidth,
+		IncludeBinnedSeries:   *includeBinned,
+		NoiseModel:            timeseries.NoiseModel(*noiseModel),
+		RefinePeaks:           *refinePeaks,
+		SampleFraction:        *sampleFraction,
+		ByMonth:               *byMonth,
+		MonthKeyFormat:        timeseries.MonthKeyFormat(*monthKeys),
+		Fundamental:           *fundamental,
+		Describe:              *describe,
+		MinQuarterRecords:     *minQuarterRecords,
+		SmoothingWindow:       *smoothingWindow,
+		IncludeRawComponents:  *includeRaw,
+		EdgeExclusionBins:     *edgeExclusionBins,
+
+		CumulativeSignificance: *cumulativeSignificance,
+
+		IncludeLongestContinuousRecords: *includeLongest,
+	}
+	if *configFile != "" {
+		if config, err = loadConfigFile(*configFile, config); err != nil {
+			log.Fatalf("Failed to load config file: %v", err)
+		}
+	}
+	// Timezone из файла -config действует, только если не задан -timezone
+	if config.Location == nil && config.Timezone != "" {
+		if config.Location, err = time.LoadLocation(config.Timezone); err != nil {
+			log.Fatalf("Invalid timezone: %v", err)
+		}
+	}
+	if config.Location != nil {
+		timestampLocation = config.Location
+	}
+
+	// Валидация итоговой конфигурации
+	if config.RollingWindow > 0 && config.RollingStep == 0 {
+		config.RollingStep = config.RollingWindow
+	}
+	if config.MinPeriod <= 0 || config.MaxPeriod <= 0 {
+		log.Fatal("Periods must be positive values")
+	}
+	if config.MinPeriod >= config.MaxPeriod {
+		log.Fatal("min-period must be less than max-period")
+	}
+	if config.NumPeriods <= 0 {
+		log.Fatal("num-periods must be at least 1")
+	}
+	if config.SamplesPerPeak <= 0 {
+		log.Fatal("samples-per-peak must be at least 1")
+	}
+	if config.MinProminence < 0 || config.MinProminence >= 1 {
+		log.Fatal("min-prominence must be in range [0, 1)")
+	}
+
+	// С -skip-bad-rows некорректные ячейки CSV пропускаются с подсчетом по столбцам
+	var skipped badCells
+	if *skipBadRows {
+		skipped = make(badCells)
+	}
+
+	// В режиме группировки анализируем каждую категорию отдельно
+	if *groupColumn > 0 {
+		groups, err := loadGroupedTimestampsFromCSV(*inputFile, *groupColumn, skipped)
+		if err != nil {
+			log.Fatalf("Failed to load timestamps: %v", err)
+		}
+		log.Printf("Loaded %d groups from %s", len(groups), *inputFile)
+		if len(skipped) > 0 {
+			log.Printf("Warning: skipped invalid CSV cells (%s)", skipped)
+		}
+
+		results, err := timeseries.AnalyzeGroups(groups, config)
+		if err != nil {
+			log.Fatalf("Analysis failed: %v", err)
+		}
+		writeOutputs(results, outputs)
+		if *failOnNoPeriods {
+			var empty []string
+			for name, result := range results {
+				if len(result.Periods.AllTime) == 0 {
+					empty = append(empty, name)
+				}
+			}
+			if len(empty) > 0 {
+				sort.Strings(empty)
+				log.Fatalf("No significant allTime periods found for groups: %s", strings.Join(empty, ", "))
+			}
+		}
+		return
+	}
+
+	// При -follow слежение начинается с конца последней полной строки на момент
+	// загрузки: дописанное позже прочитает tailReader
+	var tail *tailReader
+	if *follow {
+		if tail, err = openTail(*inputFile); err != nil {
+			log.Fatalf("Failed to follow %s: %v", *inputFile, err)
+		}
+		inputLimits[*inputFile] = tail.offset
+	}
+
+	// Загрузка временных меток и, при -value-column, значений событий и их погрешностей
+	var timestamps []int64
+	var values, sigmas []float64
+	source := *inputFile
+	switch {
+	case *sqliteFile != "":
+		source = *sqliteFile
+		timestamps, err = loadTimestampsFromSQLite(*sqliteFile, *query)
+	case *valueColumn > 0:
+		timestamps, values, sigmas, err = loadSamplesFromCSV(*inputFile, *valueColumn, *sigmaColumn, skipped)
+	default:
+		timestamps, err = loadTimestamps(*inputFile, *jsonField, skipped)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load timestamps: %v", err)
+	}
+	log.Printf("Loaded %d timestamps from %s", len(timestamps), source)
+	if len(skipped) > 0 {
+		log.Printf("Warning: skipped invalid CSV cells (%s)", skipped)
 	}
 
 	// Выполнение анализа
 	startTime := time.Now()
-	result, err := timeseries.AnalyzeTimestamps(timestamps, config)
+	var result *timeseries.AnalysisResult
+	switch {
+	case sigmas != nil:
+		samples := make([]timeseries.Sample, len(timestamps))
+		for i, ts := range timestamps {
+			samples[i] = timeseries.Sample{Time: ts, Value: values[i], Sigma: sigmas[i]}
+		}
+		result, err = timeseries.AnalyzeMeasurements(samples, config)
+	case values != nil:
+		result, err = timeseries.AnalyzeSamples(timestamps, values, config)
+	default:
+		result, err = timeseries.AnalyzeTimestamps(timestamps, config)
+	}
 	if err != nil {
 		log.Fatalf("Analysis failed: %v", err)
 	}
 	duration := time.Since(startTime)
 	log.Printf("Analysis completed in %s", duration)
+	if result.ExcludedRecords > 0 {
+		log.Printf("Excluded %d timestamps outside business hours", result.ExcludedRecords)
+	}
+	for _, warning := range result.Warnings {
+		log.Printf("Warning: %s", warning)
+	}
+	if *explain {
+		explainPeriods(os.Stderr, result.Periods)
+	}
+
+	// В режиме сравнения анализируем второй файл и выводим только различия
+	var payload interface{} = result
+	if *compareFile != "" {
+		var otherSkipped badCells
+		if *skipBadRows {
+			otherSkipped = make(badCells)
+		}
+		otherTimestamps, err := loadTimestamps(*compareFile, *jsonField, otherSkipped)
+		if err != nil {
+			log.Fatalf("Failed to load comparison timestamps: %v", err)
+		}
+		log.Printf("Loaded %d timestamps from %s", len(otherTimestamps), *compareFile)
+		if len(otherSkipped) > 0 {
+			log.Printf("Warning: skipped invalid CSV cells in %s (%s)", *compareFile, otherSkipped)
+		}
 
-	// Форматирование и вывод результатов
-	output, err := json.MarshalIndent(result, "", "  ")
+		other, err := timeseries.AnalyzeTimestamps(otherTimestamps, config)
+		if err != nil {
+			log.Fatalf("Comparison analysis failed: %v", err)
+		}
+		payload = timeseries.CompareAnalysesWithin(result, other, config.PeriodTolerance)
+	}
+
+	writeOutputs(payload, outputs)
+	if *failOnNoPeriods && len(result.Periods.AllTime) == 0 {
+		log.Fatal("No significant allTime periods found")
+	}
+	if *follow {
+		followFile(tail, timestamps, inputUnits[*inputFile], config, *followInterval)
+	}
+}
+
+// writeOutput сериализует результат в JSON и выводит его в файл или stdout
+func writeOutput(payload interface{}, outputFile string) {
+	output, err := json.MarshalIndent(payload, "", "  ")
 	if err != nil {
 		log.Fatalf("Failed to marshal results: %v", err)
 	}
 
-	// Вывод в файл или stdout
-	if *outputFile != "" {
-		if err := os.WriteFile(*outputFile, output, 0644); err != nil {
+	if outputFile != "" {
+		if err := os.WriteFile(outputFile, output, 0644); err != nil {
 			log.Fatalf("Failed to write output file: %v", err)
 		}
-		log.Printf("Results saved to %s", *outputFile)
+		log.Printf("Results saved to %s", outputFile)
 	} else {
 		fmt.Println(string(output))
 	}
 }
 
+// periodHoursFlag - значение флага периода в часах.
+// Принимает длительность Go ("6m", "24h") или, для обратной совместимости, число часов ("0.1").
+type periodHoursFlag float64
+
+func (p *periodHoursFlag) String() string {
+	return strconv.FormatFloat(float64(*p), 'g', -1, 64)
+}
+
+func (p *periodHoursFlag) Set(value string) error {
+	hours, err := parsePeriodHours(value)
+	if err != nil {
+		return err
+	}
+	*p = periodHoursFlag(hours)
+	return nil
+}
+
+// parsePeriodHours разбирает период как длительность Go, иначе как число часов
+func parsePeriodHours(value string) (float64, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d.Hours(), nil
+	}
+
+	hours, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid period %q: expected duration (e.g. 6m, 24h) or number of hours", value)
+	}
+
+	return hours, nil
+}
+
+// parseWeekday разбирает название дня недели на английском ("monday", "Sun")
+func parseWeekday(value string) (time.Weekday, error) {
+	name := strings.ToLower(value)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", value)
+}
+
+// parseScopeNumPeriods разбирает список переопределений вида "daily=3,allTime=10"
+func parseScopeNumPeriods(value string) (map[string]int, error) {
+	var limits map[string]int
+	for _, item := range splitList(value) {
+		scope, count, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid scope-num-periods entry %q: expected scope=count", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid scope-num-periods entry %q: count must be a positive integer", item)
+		}
+		if limits == nil {
+			limits = make(map[string]int)
+		}
+		limits[strings.TrimSpace(scope)] = n
+	}
+	return limits, nil
+}
+
+// parseScopePeriodRanges разбирает диапазоны периодов областей вида
+// "daily=1h:72h,weekly=12h:336h"; пустая граница ("allTime=24h:") не задана
+func parseScopePeriodRanges(value string) (map[string]timeseries.PeriodRange, error) {
+	var ranges map[string]timeseries.PeriodRange
+	for _, item := range splitList(value) {
+		scope, bounds, ok := strings.Cut(item, "=")
+		min, max, ok2 := strings.Cut(bounds, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid scope-period-ranges entry %q: expected scope=min:max", item)
+		}
+		var r timeseries.PeriodRange
+		var err error
+		if min = strings.TrimSpace(min); min != "" {
+			if r.Min, err = parsePeriodHours(min); err != nil {
+				return nil, fmt.Errorf("invalid scope-period-ranges entry %q: %v", item, err)
+			}
+		}
+		if max = strings.TrimSpace(max); max != "" {
+			if r.Max, err = parsePeriodHours(max); err != nil {
+				return nil, fmt.Errorf("invalid scope-period-ranges entry %q: %v", item, err)
+			}
+		}
+		if ranges == nil {
+			ranges = make(map[string]timeseries.PeriodRange)
+		}
+		ranges[strings.TrimSpace(scope)] = r
+	}
+	return ranges, nil
+}
+
+// parseBusinessHours разбирает рабочие часы вида "9-18" и список дней "mon,tue,..."
+func parseBusinessHours(value, days string) (*timeseries.BusinessHours, error) {
+	start, end, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid business hours %q: expected start-end, e.g. 9-18", value)
+	}
+
+	var bh timeseries.BusinessHours
+	var err error
+	if bh.Start, err = strconv.Atoi(strings.TrimSpace(start)); err != nil {
+		return nil, fmt.Errorf("invalid business hours %q: %v", value, err)
+	}
+	if bh.End, err = strconv.Atoi(strings.TrimSpace(end)); err != nil {
+		return nil, fmt.Errorf("invalid business hours %q: %v", value, err)
+	}
+
+	for _, name := range splitList(days) {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		bh.Weekdays = append(bh.Weekdays, day)
+	}
+
+	return &bh, nil
+}
+
 // loadTimestampsFromCSV загружает временные метки из CSV файла
-func loadTimestampsFromCSV(filename string) ([]int64, error) {
-	file, err := os.Open(filename)
+func loadTimestampsFromCSV(filename string, skipped badCells) ([]int64, error) {
+	groups, err := loadGroupedTimestampsFromCSV(filename, 0, skipped)
 	if err != nil {
 		return nil, err
 	}
+	return groups[""], nil
+}
+
+// loadSamplesFromCSV загружает пары (метка, значение) из CSV файла. Значение берется
+// из столбца valueColumn (нумерация с 1), при sigmaColumn > 0 его погрешность - из
+// столбца sigmaColumn, метка - из первого из остальных столбцов. При sigmaColumn == 0
+// sigmas равен nil. Строка с некорректной ячейкой пропускается, если skipped не nil.
+func loadSamplesFromCSV(filename string, valueColumn, sigmaColumn int, skipped badCells) (timestamps []int64, values, sigmas []float64, err error) {
+	file, err := openInput(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	defer file.Close()
 
+	timeColumn := 0
+	for timeColumn+1 == valueColumn || timeColumn+1 == sigmaColumn {
+		timeColumn++
+	}
+
 	reader := csv.NewReader(file)
-	var timestamps []int64
+	unit := defaultTimestampUnit
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if valueColumn > len(record) || sigmaColumn > len(record) || timeColumn >= len(record) {
+			line, _ := reader.FieldPos(0)
+			return nil, nil, nil, fmt.Errorf("line %d: expected timestamp and value columns", line)
+		}
+
+		ts, err := parseTimestamp(record[timeColumn], &unit)
+		if err != nil {
+			if skipped.skip(timeColumn + 1) {
+				continue
+			}
+			line, _ := reader.FieldPos(timeColumn)
+			return nil, nil, nil, fmt.Errorf("line %d, column %d: invalid timestamp %q", line, timeColumn+1, record[timeColumn])
+		}
+		value, err := strconv.ParseFloat(record[valueColumn-1], 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			if skipped.skip(valueColumn) {
+				continue
+			}
+			line, _ := reader.FieldPos(valueColumn - 1)
+			return nil, nil, nil, fmt.Errorf("line %d, column %d: invalid value %q", line, valueColumn, record[valueColumn-1])
+		}
+		if sigmaColumn > 0 {
+			sigma, err := strconv.ParseFloat(record[sigmaColumn-1], 64)
+			if err != nil || math.IsNaN(sigma) {
+				if skipped.skip(sigmaColumn) {
+					continue
+				}
+				line, _ := reader.FieldPos(sigmaColumn - 1)
+				return nil, nil, nil, fmt.Errorf("line %d, column %d: invalid sigma %q", line, sigmaColumn, record[sigmaColumn-1])
+			}
+			sigmas = append(sigmas, sigma)
+		}
+
+		timestamps = append(timestamps, ts)
+		values = append(values, value)
+	}
+
+	return timestamps, values, sigmas, nil
+}
+
+// loadGroupedTimestampsFromCSV загружает временные метки из CSV файла, группируя их
+// по значению столбца groupColumn (нумерация с 1). Временными метками считаются все
+// остальные столбцы. При groupColumn == 0 все метки попадают в группу "".
+// Некорректная ячейка пропускается (остальные ячейки строки загружаются), если
+// skipped не nil.
+func loadGroupedTimestampsFromCSV(filename string, groupColumn int, skipped badCells) (map[string][]int64, error) {
+	file, err := openInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	groups := make(map[string][]int64)
+	var units columnUnits
 
 	for {
 		record, err := reader.Read()
@@ -98,19 +640,33 @@ func loadTimestampsFromCSV(filename string) ([]int64, error) {
 			return nil, err
 		}
 
-		for _, value := range record {
-			if value == "" {
+		group := ""
+		if groupColumn > 0 {
+			if groupColumn > len(record) {
+				line, _ := reader.FieldPos(0)
+				return nil, fmt.Errorf("line %d: missing group column %d", line, groupColumn)
+			}
+			group = record[groupColumn-1]
+		}
+
+		for i, value := range record {
+			if value == "" || i == groupColumn-1 {
 				continue
 			}
 
-			ts, err := strconv.ParseInt(value, 10, 64)
+			ts, err := parseTimestamp(value, units.at(i))
 			if err != nil {
-				return nil, fmt.Errorf("invalid timestamp %s: %v", value, err)
+				if skipped.skip(i + 1) {
+					continue
+				}
+				line, _ := reader.FieldPos(i)
+				return nil, fmt.Errorf("line %d, column %d: invalid timestamp %q", line, i+1, value)
 			}
 
-			timestamps = append(timestamps, ts)
+			groups[group] = append(groups[group], ts)
 		}
 	}
+	inputUnits[filename] = units
 
-	return timestamps, nil
+	return groups, nil
 }
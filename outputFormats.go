@@ -0,0 +1,223 @@
+package main
+
+import (
+	"AT/timeseries"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы вывода для -output format:path
+const (
+	formatJSON     = "json"     // Полный результат в JSON
+	formatCSV      = "csv"      // Найденные периоды всех областей, по строке на период
+	formatSpectrum = "spectrum" // Периодограммы из -spectrum-scopes в CSV
+	formatInflux   = "influx"   // Ряды по дням, неделям и месяцам в line protocol InfluxDB
+)
+
+// outputTarget - файл вывода и формат его содержимого. Пустой путь - stdout.
+type outputTarget struct {
+	format string
+	path   string
+}
+
+// outputsFlag накапливает повторяющиеся флаги -output вида "path" или "format:path"
+type outputsFlag []outputTarget
+
+func (o *outputsFlag) String() string {
+	var items []string
+	for _, target := range *o {
+		items = append(items, target.format+":"+target.path)
+	}
+	return strings.Join(items, ",")
+}
+
+// Set разбирает "format:path". Префикс, похожий на название формата (две и более
+// строчные латинские буквы или цифры), должен быть известным форматом, чтобы опечатка
+// вроде "yml:out.yaml" не превращалась молча в путь JSON-файла; однобуквенный
+// префикс - диск Windows ("C:\out.json").
+func (o *outputsFlag) Set(value string) error {
+	target := outputTarget{format: formatJSON, path: value}
+	if format, path, ok := strings.Cut(value, ":"); ok {
+		switch {
+		case format == formatJSON || format == formatCSV || format == formatSpectrum || format == formatInflux:
+			target = outputTarget{format: format, path: path}
+		case looksLikeFormat(format):
+			return fmt.Errorf("unknown output format %q (want %s, %s, %s or %s)",
+				format, formatJSON, formatCSV, formatSpectrum, formatInflux)
+		}
+	}
+	*o = append(*o, target)
+	return nil
+}
+
+// looksLikeFormat проверяет, похож ли префикс -output на название формата
+func looksLikeFormat(prefix string) bool {
+	if len(prefix) < 2 {
+		return false
+	}
+	for _, r := range prefix {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeOutputs записывает payload во все файлы вывода; без -output - JSON в stdout
+func writeOutputs(payload interface{}, targets outputsFlag) {
+	if len(targets) == 0 {
+		writeOutput(payload, "")
+		return
+	}
+
+	for _, target := range targets {
+		if target.format == formatJSON {
+			writeOutput(payload, target.path)
+			continue
+		}
+
+		result, ok := payload.(*timeseries.AnalysisResult)
+		if !ok {
+			log.Fatalf("Output format %s is only available for a single analysis", target.format)
+		}
+
+		var buf bytes.Buffer
+		if target.format == formatInflux {
+			writeInflux(&buf, result)
+		} else {
+			writer := csv.NewWriter(&buf)
+			if target.format == formatCSV {
+				writePeriodsCSV(writer, result)
+			} else {
+				if len(result.Spectra) == 0 {
+					log.Printf("Warning: no spectra to write to %s; use -spectrum-scopes", target.path)
+				}
+				writeSpectrumCSV(writer, result)
+			}
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				log.Fatalf("Failed to format %s output: %v", target.format, err)
+			}
+		}
+
+		if target.path == "" {
+			fmt.Print(buf.String())
+			continue
+		}
+		if err := os.WriteFile(target.path, buf.Bytes(), 0644); err != nil {
+			log.Fatalf("Failed to write output file: %v", err)
+		}
+		log.Printf("Results saved to %s", target.path)
+	}
+}
+
+// writePeriodsCSV записывает периоды всех областей: scope,rank,period,periodLabel,power,significance,pValue
+func writePeriodsCSV(writer *csv.Writer, result *timeseries.AnalysisResult) {
+	writer.Write([]string{"scope", "rank", "period", "periodLabel", "power", "significance", "pValue"})
+
+	writeScope := func(scope string, periods []timeseries.PeriodResult) {
+		for i, p := range periods {
+			writer.Write([]string{
+				scope,
+				strconv.Itoa(i + 1),
+				strconv.FormatFloat(p.Period, 'g', -1, 64),
+				p.PeriodLabel,
+				strconv.FormatFloat(p.Power, 'g', -1, 64),
+				strconv.FormatFloat(p.Significance, 'g', -1, 64),
+				strconv.FormatFloat(p.PValue, 'g', -1, 64),
+			})
+		}
+	}
+	writeResults := func(prefix string, pr timeseries.PeriodResults) {
+		writeScope(prefix+timeseries.ScopeDaily, pr.Daily)
+		writeScope(prefix+timeseries.ScopeWeekly, pr.Weekly)
+		writeScope(prefix+timeseries.ScopeAllTime, pr.AllTime)
+		quarters := make([]string, 0, len(pr.Quarterly))
+		for quarter := range pr.Quarterly {
+			quarters = append(quarters, quarter)
+		}
+		sort.Strings(quarters)
+		for _, quarter := range quarters {
+			writeScope(prefix+timeseries.ScopeQuarterly+"/"+quarter, pr.Quarterly[quarter])
+		}
+		months := make([]string, 0, len(pr.Monthly))
+		for month := range pr.Monthly {
+			months = append(months, month)
+		}
+		sort.Slice(months, func(i, j int) bool { return monthKeyTime(months[i]).Before(monthKeyTime(months[j])) })
+		for _, month := range months {
+			writeScope(prefix+timeseries.ScopeMonthly+"/"+month, pr.Monthly[month])
+		}
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if periods, ok := pr.Weekdays[day]; ok {
+				writeScope(prefix+timeseries.ScopeWeekday+"/"+day.String(), periods)
+			}
+		}
+	}
+
+	writeResults("", result.Periods)
+	writeResults(timeseries.ScopeContinuousAll+"/", result.Continuous.AllData)
+	writeResults(timeseries.ScopeContinuousLongest+"/", result.Continuous.LongestContinuous)
+	for _, window := range result.Rolling {
+		writeScope(timeseries.ScopeRolling+"/"+window.Start.Format(time.RFC3339), window.Periods)
+	}
+}
+
+// monthKeyTime разбирает ключ PeriodResults.Monthly в любом из форматов MonthKeyFormat,
+// чтобы месяцы выводились по порядку, а не по алфавиту названий
+func monthKeyTime(key string) time.Time {
+	for _, layout := range []string{"2006-01", "January 2006"} {
+		if t, err := time.Parse(layout, key); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// writeSpectrumCSV записывает сохраненные периодограммы: scope,frequency,period,power
+func writeSpectrumCSV(writer *csv.Writer, result *timeseries.AnalysisResult) {
+	writer.Write([]string{"scope", "frequency", "period", "power"})
+	scopes := make([]string, 0, len(result.Spectra))
+	for scope := range result.Spectra {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		spectrum := result.Spectra[scope]
+		for i, f := range spectrum.Frequencies {
+			writer.Write([]string{
+				scope,
+				strconv.FormatFloat(f, 'g', -1, 64),
+				strconv.FormatFloat(1/f, 'g', -1, 64),
+				strconv.FormatFloat(spectrum.Powers[i], 'g', -1, 64),
+			})
+		}
+	}
+}
+
+// writeInflux записывает ряды по дням, неделям и месяцам в line protocol InfluxDB
+func writeInflux(w io.Writer, result *timeseries.AnalysisResult) {
+	for _, d := range result.Days {
+		writeInfluxPoint(w, "day", d.Count, d.Date)
+	}
+	for _, week := range result.Weeks {
+		writeInfluxPoint(w, "week", week.Count, week.Week)
+	}
+	for _, m := range result.Months {
+		writeInfluxPoint(w, "month", m.Count, m.Month)
+	}
+}
+
+// writeInfluxPoint записывает точку "events,bucket=<bucket> count=<count>i <ns>":
+// count - целочисленное поле, метка времени - начало интервала в наносекундах
+func writeInfluxPoint(w io.Writer, bucket string, count int, start time.Time) {
+	fmt.Fprintf(w, "events,bucket=%s count=%di %d\n", bucket, count, start.UnixNano())
+}
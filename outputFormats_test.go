@@ -0,0 +1,63 @@
+package main
+
+import (
+	"AT/timeseries"
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputsFlagSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    outputTarget
+		wantErr bool
+	}{
+		{value: "out.json", want: outputTarget{format: formatJSON, path: "out.json"}},
+		{value: "csv:periods.csv", want: outputTarget{format: formatCSV, path: "periods.csv"}},
+		{value: `C:\results\out.json`, want: outputTarget{format: formatJSON, path: `C:\results\out.json`}},
+		{value: "yml:out.yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		var outputs outputsFlag
+		err := outputs.Set(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q): expected an error", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Set(%q): %v", tt.value, err)
+			continue
+		}
+		if outputs[0] != tt.want {
+			t.Errorf("Set(%q) = %+v, want %+v", tt.value, outputs[0], tt.want)
+		}
+	}
+}
+
+func TestPeriodsCSVIncludesMonthlyAndRolling(t *testing.T) {
+	period := []timeseries.PeriodResult{{Period: 24}}
+	result := &timeseries.AnalysisResult{
+		Periods: timeseries.PeriodResults{
+			Monthly: map[string][]timeseries.PeriodResult{"July 2023": period, "June 2023": period},
+		},
+		Rolling: []timeseries.RollingResult{{Start: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC), Periods: period}},
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writePeriodsCSV(writer, result)
+	writer.Flush()
+
+	var scopes []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n")[1:] {
+		scopes = append(scopes, strings.SplitN(line, ",", 2)[0])
+	}
+	want := []string{"monthly/June 2023", "monthly/July 2023", "rolling/2023-06-01T00:00:00Z"}
+	if strings.Join(scopes, ";") != strings.Join(want, ";") {
+		t.Errorf("scopes = %q, want %q", scopes, want)
+	}
+}
@@ -0,0 +1,128 @@
+package timeseries
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RayleighResult - результат теста Рэлея для периода PeriodResult
+type RayleighResult struct {
+	R         float64 `json:"r"`         // Длина среднего вектора фаз (0 - равномерно, 1 - одна фаза)
+	PValue    float64 `json:"pValue"`    // Вероятность такой концентрации фаз при равномерном распределении
+	MeanPhase float64 `json:"meanPhase"` // Средняя фаза в радианах [0, 2π), отсчитывается от начала эпохи Unix
+}
+
+// RayleighTest проверяет, сосредоточены ли события в определенной фазе цикла длиной
+// periodHours. Фаза события θ = 2π·t/P, где t - часы от начала эпохи Unix, поэтому
+// для периода 24 часа meanPhase соответствует времени суток по UTC:
+// meanPhase / 2π · 24 - час пика активности.
+//
+// r - длина среднего вектора e^{iθ}, meanPhase - его направление. pValue вычисляется
+// для статистики Z = n·r² по асимптотическому ряду Гринвуда и Дюрана (Greenwood, Durand,
+// Ann. Math. Statist. 26, 1955; см. также Mardia, Jupp, Directional Statistics, 2000):
+// P ≈ e^{-Z}·[1 + (2Z − Z²)/4n − (24Z − 132Z² + 76Z³ − 9Z⁴)/288n²], точный уже при
+// n ≥ 10. Тест предполагает независимые события; в отличие от
+// пика периодограммы, он проверяет один заранее выбранный период, поэтому поправка на
+// множественные сравнения не нужна.
+func RayleighTest(times []time.Time, periodHours float64) (r float64, pValue float64, meanPhase float64) {
+	n := float64(len(times))
+	if n == 0 || periodHours <= 0 {
+		return 0, 1, 0
+	}
+
+	omega := 2 * math.Pi / periodHours
+	var sumCos, sumSin float64
+	for _, t := range times {
+		// Остаток от деления на период до умножения сохраняет точность фазы
+		// для больших t
+		hours := float64(t.UnixNano()) / float64(time.Hour)
+		theta := omega * math.Mod(hours, periodHours)
+		sumCos += math.Cos(theta)
+		sumSin += math.Sin(theta)
+	}
+
+	r = math.Hypot(sumCos, sumSin) / n
+	meanPhase = math.Atan2(sumSin, sumCos)
+	if meanPhase < 0 {
+		meanPhase += 2 * math.Pi
+	}
+
+	z := n * r * r
+	pValue = math.Exp(-z) * (1 + (2*z-z*z)/(4*n) - (24*z-132*z*z+76*z*z*z-9*z*z*z*z)/(288*n*n))
+	pValue = math.Max(0, math.Min(1, pValue))
+
+	return r, pValue, meanPhase
+}
+
+// rayleighForTop дополняет самый сильный период области результатом теста Рэлея
+func rayleighForTop(periods []PeriodResult, times []time.Time) {
+	if len(periods) == 0 || len(times) == 0 {
+		return
+	}
+	r, pValue, meanPhase := RayleighTest(times, periods[0].Period)
+	periods[0].Rayleigh = &RayleighResult{R: r, PValue: pValue, MeanPhase: meanPhase}
+}
+
+// descriptionMinR - наименьшая длина среднего вектора фаз, при которой describePeriod
+// указывает время или день пика активности
+const descriptionMinR = 0.2
+
+// describePeriod возвращает описание периода для расписаний, если он совпадает с
+// сутками или неделей с допуском tolerance, и пустую строку для остальных периодов.
+// События сворачиваются с календарным циклом по местному времени loc (а не по UTC,
+// как в RayleighTest), и пик активности - направление среднего вектора фаз:
+// "daily ~09:00" или "weekly on Mondays". Если фазы распределены почти равномерно
+// (длина вектора меньше descriptionMinR), пик не указывается: "daily", "weekly".
+func describePeriod(period float64, times []time.Time, loc *time.Location, tolerance float64) string {
+	switch {
+	case periodsMatch(period, 24, tolerance):
+		r, phase := calendarPhase(times, loc, false)
+		if r < descriptionMinR {
+			return "daily"
+		}
+		minutes := int(math.Round(phase*24*60)) % (24 * 60)
+		return fmt.Sprintf("daily ~%02d:%02d", minutes/60, minutes%60)
+	case periodsMatch(period, 168, tolerance):
+		r, phase := calendarPhase(times, loc, true)
+		if r < descriptionMinR {
+			return "weekly"
+		}
+		return fmt.Sprintf("weekly on %ss", time.Weekday(int(phase*7)%7))
+	default:
+		return ""
+	}
+}
+
+// calendarPhase возвращает длину среднего вектора фаз событий в сутках (или, при
+// weekly, в неделе с воскресенья) по местному времени loc и его направление как
+// долю цикла [0, 1)
+func calendarPhase(times []time.Time, loc *time.Location, weekly bool) (r, phase float64) {
+	if len(times) == 0 {
+		return 0, 0
+	}
+	cycle := 24 * time.Hour
+	if weekly {
+		cycle = 7 * 24 * time.Hour
+	}
+
+	var sumCos, sumSin float64
+	for _, t := range times {
+		local := t.In(loc)
+		offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+			time.Duration(local.Second())*time.Second
+		if weekly {
+			offset += time.Duration(local.Weekday()) * 24 * time.Hour
+		}
+		theta := 2 * math.Pi * float64(offset) / float64(cycle)
+		sumCos += math.Cos(theta)
+		sumSin += math.Sin(theta)
+	}
+
+	r = math.Hypot(sumCos, sumSin) / float64(len(times))
+	phase = math.Atan2(sumSin, sumCos) / (2 * math.Pi)
+	if phase < 0 {
+		phase++
+	}
+	return r, phase
+}
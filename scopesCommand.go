@@ -0,0 +1,31 @@
+package main
+
+import (
+	"AT/timeseries"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func init() {
+	subcommands["scopes"] = runScopes
+}
+
+// runScopes выводит области анализа, их окна по умолчанию и управляющие поля
+// конфигурации: AT scopes
+func runScopes(args []string) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "SCOPE\tKEY\tDEFAULT WINDOW\tCONFIG FIELDS\tDESCRIPTION")
+	for _, scope := range timeseries.Scopes(timeseries.DefaultPeriodConfig()) {
+		key, window := scope.Key, "-"
+		if key == "" {
+			key = "-"
+		}
+		if scope.Window > 0 {
+			window = scope.Window.String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", scope.Name, key, window, strings.Join(scope.Fields, ", "), scope.Description)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,13 @@
+//go:build sqlite
+
+// Сборка с поддержкой SQLite: go build -tags sqlite
+
+package main
+
+import (
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	sqliteDriver = "sqlite"
+}
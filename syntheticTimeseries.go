@@ -0,0 +1,67 @@
+package timeseries
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// SyntheticSpec описывает синтетический поток событий с известными периодами
+type SyntheticSpec struct {
+	Start      time.Time     // Начало ряда (по умолчанию 2023-01-01 UTC)
+	Span       time.Duration // Длительность ряда
+	Rate       float64       // Средняя интенсивность событий в час
+	Periods    []float64     // Внедряемые периоды в часах
+	Amplitudes []float64     // Глубина модуляции для каждого периода (0..1, по умолчанию 1)
+	Noise      float64       // Доля немодулированных (равномерных) событий (0..1)
+	Seed       int64         // Зерно генератора случайных чисел
+}
+
+// GenerateSyntheticTimestamps генерирует временные метки (в миллисекундах) неоднородного
+// пуассоновского процесса с интенсивностью
+//
+//	λ(t) = Rate * ((1-Noise) * (1 + Σ a_i cos(2πt/P_i)) + Noise)
+//
+// методом прореживания. Одинаковая спецификация всегда дает одинаковый результат.
+func GenerateSyntheticTimestamps(spec SyntheticSpec) []int64 {
+	if spec.Span <= 0 || spec.Rate <= 0 {
+		return nil
+	}
+
+	start := spec.Start
+	if start.IsZero() {
+		start = time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	noise := math.Min(math.Max(spec.Noise, 0), 1)
+
+	amplitudes := make([]float64, len(spec.Periods))
+	maxModulation := 1.0
+	for i := range spec.Periods {
+		amplitudes[i] = 1
+		if i < len(spec.Amplitudes) {
+			amplitudes[i] = spec.Amplitudes[i]
+		}
+		maxModulation += math.Abs(amplitudes[i])
+	}
+
+	// Мажорирующая интенсивность для прореживания
+	maxRate := spec.Rate * ((1-noise)*maxModulation + noise)
+	spanHours := spec.Span.Hours()
+	rng := rand.New(rand.NewSource(spec.Seed))
+
+	var timestamps []int64
+	for t := rng.ExpFloat64() / maxRate; t < spanHours; t += rng.ExpFloat64() / maxRate {
+		modulation := 1.0
+		for i, period := range spec.Periods {
+			modulation += amplitudes[i] * math.Cos(2*math.Pi*t/period)
+		}
+		rate := spec.Rate * ((1-noise)*math.Max(modulation, 0) + noise)
+
+		if rng.Float64()*maxRate < rate {
+			ts := start.Add(time.Duration(t * float64(time.Hour)))
+			timestamps = append(timestamps, ts.UnixMilli())
+		}
+	}
+
+	return timestamps
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadTimestamps загружает временные метки, выбирая формат по расширению файла:
+// .txt - одно число на строку, .jsonl/.ndjson - JSON Lines с полем jsonField,
+// иначе CSV. Любой формат может быть сжат gzip (суффикс .gz). Некорректные ячейки
+// CSV пропускаются и учитываются в skipped, если он не nil.
+func loadTimestamps(filename, jsonField string, skipped badCells) ([]int64, error) {
+	name := strings.TrimSuffix(strings.ToLower(filename), ".gz")
+
+	switch filepath.Ext(name) {
+	case ".txt":
+		return loadTimestampsFromLines(filename)
+	case ".jsonl", ".ndjson":
+		return loadTimestampsFromJSONL(filename, jsonField)
+	default:
+		return loadTimestampsFromCSV(filename, skipped)
+	}
+}
+
+// badCells - количество пропущенных некорректных ячеек CSV по номеру столбца (с 1).
+// Загрузчик с nil вместо badCells прерывает загрузку на первой некорректной ячейке.
+type badCells map[int]int
+
+// skip учитывает некорректную ячейку столбца column (с 1) и сообщает, можно ли ее
+// пропустить
+func (b badCells) skip(column int) bool {
+	if b == nil {
+		return false
+	}
+	b[column]++
+	return true
+}
+
+// String перечисляет пропуски по возрастанию номера столбца: "column 2: 3, column 5: 1"
+func (b badCells) String() string {
+	columns := make([]int, 0, len(b))
+	for column := range b {
+		columns = append(columns, column)
+	}
+	sort.Ints(columns)
+	items := make([]string, len(columns))
+	for i, column := range columns {
+		items[i] = fmt.Sprintf("column %d: %d", column, b[column])
+	}
+	return strings.Join(items, ", ")
+}
+
+// inputLimits - число первых байт несжатого файла, которые читает openInput. При
+// -follow начальная загрузка читает файл только до смещения, с которого продолжит
+// tailReader, чтобы строки, дописанные во время загрузки, не потерялись и не
+// учитывались дважды.
+var inputLimits = map[string]int64{}
+
+// inputUnits - единицы числовых меток по столбцам, определенные при загрузке файла
+// CSV или .txt. При -follow дописанные строки разбираются в тех же единицах, а не
+// определяют их заново по первой новой строке.
+var inputUnits = map[string]columnUnits{}
+
+// openInput открывает файл, прозрачно распаковывая его, если имя оканчивается на .gz
+func openInput(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".gz") {
+		if limit, ok := inputLimits[filename]; ok {
+			return &limitedFile{Reader: io.LimitReader(file, limit), file: file}, nil
+		}
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: reader, file: file}, nil
+}
+
+// gzipFile закрывает и распаковщик, и исходный файл
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// limitedFile читает начало файла по inputLimits и закрывает файл
+type limitedFile struct {
+	io.Reader
+	file *os.File
+}
+
+func (l *limitedFile) Close() error {
+	return l.file.Close()
+}
+
+// scanLines вызывает fn для каждой непустой строки файла с ее номером (с 1)
+func scanLines(filename string, fn func(line int, text string) error) error {
+	input, err := openInput(filename)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if err := fn(line, text); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// timestampUnit - единица числовых меток столбца или файла
+type timestampUnit int
+
+const (
+	unitAuto    timestampUnit = iota // Определяется по первому числу: целое - мс, дробное - с
+	unitMillis                       // Миллисекунды Unix
+	unitSeconds                      // Секунды Unix
+)
+
+// parseTimestampUnit разбирает значение -timestamp-unit: auto, ms или s
+func parseTimestampUnit(value string) (timestampUnit, error) {
+	switch value {
+	case "auto":
+		return unitAuto, nil
+	case "ms":
+		return unitMillis, nil
+	case "s":
+		return unitSeconds, nil
+	}
+	return unitAuto, fmt.Errorf("invalid timestamp unit %q: expected auto, ms or s", value)
+}
+
+// defaultTimestampUnit - начальная единица числовых меток каждого столбца; задается
+// флагом -timestamp-unit
+var defaultTimestampUnit = unitAuto
+
+// columnUnits - единицы числовых меток по номеру столбца (с 0)
+type columnUnits []timestampUnit
+
+// at возвращает единицу столбца column для parseTimestamp
+func (c *columnUnits) at(column int) *timestampUnit {
+	for len(*c) <= column {
+		*c = append(*c, defaultTimestampUnit)
+	}
+	return &(*c)[column]
+}
+
+// parseTimestamp разбирает число миллисекунд или секунд Unix в единице *unit.
+// Единица выбирается один раз на столбец или файл: при unitAuto ее определяет
+// первое число - целое ("1687000000123") означает миллисекунды, дробное
+// ("1687000000.123") - секунды, и *unit запоминает выбор. Поэтому 1700000000 и
+// 1700000000.5 в одном столбце никогда не расходятся в 1000 раз; для столбца
+// секунд, начинающегося с целого числа, единицу нужно задать -timestamp-unit s.
+// Иначе значение разбирается как RFC3339 ("2023-06-01T12:00:00+09:00"): смещение
+// определяет абсолютный момент и не сохраняется, календарные интервалы затем
+// считаются в PeriodConfig.Location. Метка без смещения ("2023-06-01T12:00:00")
+// считается местным временем timestampLocation: часового пояса -timezone или,
+// если он не задан, UTC.
+func parseTimestamp(value string, unit *timestampUnit) (int64, error) {
+	if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if *unit == unitAuto {
+			*unit = unitMillis
+		}
+		if *unit == unitSeconds {
+			if ts > math.MaxInt64/1000 || ts < math.MinInt64/1000 {
+				return 0, fmt.Errorf("invalid timestamp %q", value)
+			}
+			return ts * 1000, nil
+		}
+		return ts, nil
+	}
+
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		ts, err := floatTimestamp(number, unit)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+		return ts, nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		if t, err = time.ParseInLocation(zonelessLayout, value, timestampLocation); err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", value)
+		}
+	}
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+// floatTimestamp переводит дробное число в единице *unit в миллисекунды Unix. При
+// unitAuto число считается секундами, и *unit запоминает выбор, как в parseTimestamp.
+// Значения вне диапазона int64 - ошибка, а не неопределенный результат преобразования.
+func floatTimestamp(number float64, unit *timestampUnit) (int64, error) {
+	if *unit == unitAuto {
+		*unit = unitSeconds
+	}
+	ms := number
+	if *unit == unitSeconds {
+		ms *= 1000
+	}
+	ms = math.Round(ms)
+	if math.IsNaN(ms) || ms < math.MinInt64 || ms >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid timestamp %g", number)
+	}
+	return int64(ms), nil
+}
+
+// zonelessLayout - формат меток RFC3339 без смещения, с необязательными долями секунды
+const zonelessLayout = "2006-01-02T15:04:05.999999999"
+
+// timestampLocation - часовой пояс, в котором parseTimestamp читает метки без смещения.
+// Задается флагом -timezone (или Timezone в файле -config) вместе с PeriodConfig.Location.
+// По умолчанию - UTC, а не локальный пояс, чтобы один и тот же файл читался одинаково на любой машине.
+var timestampLocation = time.UTC
+
+// loadTimestampsFromLines загружает временные метки из файла с одним числом на строку
+func loadTimestampsFromLines(filename string) ([]int64, error) {
+	var timestamps []int64
+	unit := defaultTimestampUnit
+
+	err := scanLines(filename, func(line int, text string) error {
+		ts, err := parseTimestamp(text, &unit)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid timestamp %q", line, text)
+		}
+		timestamps = append(timestamps, ts)
+		return nil
+	})
+	inputUnits[filename] = columnUnits{unit}
+
+	return timestamps, err
+}
+
+// loadTimestampsFromJSONL загружает временные метки из JSON Lines вида {"ts": 1687000000000}.
+// field задает имя поля с меткой; путь через точку ("event.timestamp") выбирает
+// поле вложенного объекта.
+func loadTimestampsFromJSONL(filename, field string) ([]int64, error) {
+	var timestamps []int64
+	path := strings.Split(field, ".")
+	unit := defaultTimestampUnit
+
+	err := scanLines(filename, func(line int, text string) error {
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.UseNumber()
+
+		var record map[string]interface{}
+		if err := decoder.Decode(&record); err != nil {
+			return fmt.Errorf("line %d: invalid JSON: %v", line, err)
+		}
+
+		raw, ok := lookupJSONPath(record, path)
+		if !ok {
+			return fmt.Errorf("line %d: missing field %q", line, field)
+		}
+		var value string
+		switch v := raw.(type) {
+		case json.Number:
+			value = v.String()
+		case string:
+			value = v
+		default:
+			return fmt.Errorf("line %d: field %q is not a number or RFC3339 string", line, field)
+		}
+		ts, err := parseTimestamp(value, &unit)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid timestamp %q", line, value)
+		}
+
+		timestamps = append(timestamps, ts)
+		return nil
+	})
+
+	return timestamps, err
+}
+
+// lookupJSONPath спускается по вложенным объектам record по ключам path
+func lookupJSONPath(record map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = record
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// sqliteDriver - имя драйвера database/sql для SQLite; задается при сборке с тегом sqlite
+var sqliteDriver string
+
+// loadTimestampsFromSQLite выполняет запрос к базе SQLite и читает временные метки из
+// первого столбца результата. Строки читаются по одной, без загрузки всего результата.
+// Числа и строки разбираются parseTimestamp с единой единицей для всего столбца,
+// значения DATETIME - как моменты времени.
+func loadTimestampsFromSQLite(filename, query string) ([]int64, error) {
+	if sqliteDriver == "" {
+		return nil, fmt.Errorf("SQLite support is not built in; rebuild with -tags sqlite")
+	}
+
+	db, err := sql.Open(sqliteDriver, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("query returns no columns")
+	}
+
+	// Остальные столбцы читаются и отбрасываются
+	values := make([]interface{}, len(columns))
+	targets := make([]interface{}, len(columns))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+
+	var timestamps []int64
+	unit := defaultTimestampUnit
+	for row := 1; rows.Next(); row++ {
+		if err := rows.Scan(targets...); err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		ts, err := sqlTimestamp(values[0], &unit)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+		timestamps = append(timestamps, ts)
+	}
+
+	return timestamps, rows.Err()
+}
+
+// sqlTimestamp переводит значение столбца SQL в миллисекунды Unix; unit - единица
+// числовых значений столбца, как в parseTimestamp. Значение REAL разбирается как
+// дробное число, даже если дробная часть нулевая (1687000000.0 - секунды при unitAuto).
+func sqlTimestamp(value interface{}, unit *timestampUnit) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return parseTimestamp(strconv.FormatInt(v, 10), unit)
+	case float64:
+		return floatTimestamp(v, unit)
+	case []byte:
+		return parseTimestamp(strings.TrimSpace(string(v)), unit)
+	case string:
+		return parseTimestamp(strings.TrimSpace(v), unit)
+	case time.Time:
+		return v.UnixNano() / int64(time.Millisecond), nil
+	case nil:
+		return 0, fmt.Errorf("timestamp is NULL")
+	default:
+		return 0, fmt.Errorf("unsupported timestamp type %T", value)
+	}
+}
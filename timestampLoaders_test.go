@@ -0,0 +1,111 @@
+package main
+
+import (
+	"AT/timeseries"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseTimestampMixedOffsets(t *testing.T) {
+	// Вечер 1 июня в Нью-Йорке (UTC-4), записанный с разными смещениями: по UTC
+	// все метки приходятся уже на 2 июня
+	values := []string{
+		"2023-06-01T21:00:00-04:00",
+		"2023-06-02T01:30:00Z",
+		"2023-06-02T10:00:00+09:00",
+		"2023-06-01T23:59:59-04:00",
+	}
+	var unit timestampUnit
+	timestamps := make([]int64, len(values))
+	for i, value := range values {
+		ts, err := parseTimestamp(value, &unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		timestamps[i] = ts
+	}
+	if want := time.Date(2023, 6, 2, 1, 0, 0, 0, time.UTC).UnixMilli(); timestamps[0] != want {
+		t.Errorf("parseTimestamp(%q) = %d, want %d", values[0], timestamps[0], want)
+	}
+
+	newYork := time.FixedZone("UTC-4", -4*60*60)
+	days, err := timeseries.AggregateTimestamps(timestamps, timeseries.AggregateDay, timeseries.PeriodConfig{Location: newYork})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || days[0].Count != len(values) || !days[0].Start.Equal(time.Date(2023, 6, 1, 0, 0, 0, 0, newYork)) {
+		t.Errorf("days in UTC-4 = %+v, want all events on June 1", days)
+	}
+
+	if days, err = timeseries.AggregateTimestamps(timestamps, timeseries.AggregateDay, timeseries.PeriodConfig{Location: time.UTC}); err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || !days[0].Start.Equal(time.Date(2023, 6, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("days in UTC = %+v, want all events on June 2", days)
+	}
+}
+
+func TestParseTimestampWithoutOffset(t *testing.T) {
+	var unit timestampUnit
+	want := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+	if ts, err := parseTimestamp("2023-06-01T12:00:00", &unit); err != nil || ts != want {
+		t.Errorf("parseTimestamp = %d, %v; want %d (UTC)", ts, err, want)
+	}
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer func(loc *time.Location) { timestampLocation = loc }(timestampLocation)
+	timestampLocation = tokyo
+	want = time.Date(2023, 6, 1, 12, 0, 0, 0, tokyo).UnixMilli()
+	if ts, err := parseTimestamp("2023-06-01T12:00:00", &unit); err != nil || ts != want {
+		t.Errorf("parseTimestamp in Tokyo = %d, %v; want %d", ts, err, want)
+	}
+
+	if _, err := parseTimestamp("2023-06-01 noon", &unit); err == nil {
+		t.Error("expected an error for an unsupported layout")
+	}
+}
+
+func TestParseTimestampUnitPerColumn(t *testing.T) {
+	tests := []struct {
+		name   string
+		unit   timestampUnit
+		values []string
+		want   []int64
+	}{
+		{"integer first", unitAuto, []string{"1700000000000", "1700000000000.5"}, []int64{1700000000000, 1700000000001}},
+		{"fractional first", unitAuto, []string{"1700000000.5", "1700000001"}, []int64{1700000000500, 1700000001000}},
+		{"explicit seconds", unitSeconds, []string{"1700000000", "1700000000.5"}, []int64{1700000000000, 1700000000500}},
+	}
+	for _, tt := range tests {
+		unit := tt.unit
+		for i, value := range tt.values {
+			ts, err := parseTimestamp(value, &unit)
+			if err != nil || ts != tt.want[i] {
+				t.Errorf("%s: parseTimestamp(%q) = %d, %v; want %d", tt.name, value, ts, err, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSQLTimestampRealColumn(t *testing.T) {
+	// Столбец REAL: целое первое значение не должно переводить столбец в миллисекунды
+	column := []interface{}{1687000000.0, 1687000000.25, 1687000001.0}
+	want := []int64{1687000000000, 1687000000250, 1687000001000}
+	unit := unitAuto
+	for i, value := range column {
+		if ts, err := sqlTimestamp(value, &unit); err != nil || ts != want[i] {
+			t.Errorf("sqlTimestamp(%v) = %d, %v; want %d", value, ts, err, want[i])
+		}
+	}
+
+	for _, value := range []interface{}{1e300, math.NaN(), "1e300", "-1e300"} {
+		unit := unitAuto
+		if ts, err := sqlTimestamp(value, &unit); err == nil {
+			t.Errorf("sqlTimestamp(%v) = %d, want an error", value, ts)
+		}
+	}
+}